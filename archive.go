@@ -0,0 +1,203 @@
+package maxclientapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultArchiveTemplate — шаблон пути по умолчанию для WithMediaArchive
+const DefaultArchiveTemplate = "{chat}/{date}/{id}_{name}"
+
+// ArchiveManifest записывается рядом с каждым сохраненным файлом (путь + ".json")
+type ArchiveManifest struct {
+	ChatID       interface{} `json:"chat_id"`
+	MessageID    interface{} `json:"message_id"`
+	Sender       interface{} `json:"sender"`
+	Time         interface{} `json:"time"`
+	Type         string      `json:"type"`
+	Name         string      `json:"name"`
+	Size         int64       `json:"size"`
+	Attach       Attachment  `json:"attach"`
+	DownloadedAt time.Time   `json:"downloaded_at"`
+}
+
+// mediaArchiver скачивает медиа из отслеживаемых чатов в отдельной горутине,
+// чтобы не блокировать listenHandler: ссылки на видео и файлы запрашиваются через него же
+type mediaArchiver struct {
+	dir      string
+	template string
+	jobs     chan archiveJob
+}
+
+type archiveJob struct {
+	request  DownloadRequest
+	manifest ArchiveManifest
+}
+
+// WithMediaArchive включает автоматическое сохранение фото, видео, файлов и голосовых
+// сообщений из чатов WatchChats в dir. Путь внутри dir задается шаблоном с полями
+// {chat}, {date}, {id}, {sender}, {type}, {name}; пустой шаблон — DefaultArchiveTemplate
+func WithMediaArchive(dir, template string) Option {
+	return func(c *ChatClient) {
+		if template == "" {
+			template = DefaultArchiveTemplate
+		}
+		c.archiver = &mediaArchiver{
+			dir:      dir,
+			template: template,
+			jobs:     make(chan archiveJob, 100),
+		}
+	}
+}
+
+// runArchiver обрабатывает очередь архивации
+func (c *ChatClient) runArchiver() {
+	downloader := c.NewDownloader()
+
+	// Close прерывает текущую загрузку, а не ждет таймаута HTTP клиента
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		var job archiveJob
+		select {
+		case job = <-c.archiver.jobs:
+		case <-c.closing:
+			return
+		}
+		path := filepath.Join(c.archiver.dir, c.archiver.expand(job.manifest))
+		// Сообщение, повторно доставленное после переподключения, уже сохранено
+		if _, err := os.Stat(path); err == nil {
+			c.logger.Debug("archive file exists, skipped", "path", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			c.logger.Error("archive failed", "path", path, "err", err)
+			continue
+		}
+		if err := downloader.DownloadFileContext(ctx, job.request, path); err != nil {
+			c.logger.Error("archive download failed", "path", path, "chat_id", job.manifest.ChatID, "err", err)
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			job.manifest.Size = info.Size()
+		}
+		job.manifest.DownloadedAt = time.Now()
+
+		data, err := json.MarshalIndent(job.manifest, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path+".json", data, 0o644)
+		}
+		if err != nil {
+			c.logger.Error("archive manifest failed", "path", path, "err", err)
+		}
+	}
+}
+
+// archiveMessage ставит медиа из сообщения в очередь, если чат отслеживается
+func (c *ChatClient) archiveMessage(payload, messageData map[string]interface{}) {
+	chatID := payload["chatId"]
+	if c.archiver == nil || !c.isWatched(chatID) {
+		return
+	}
+
+	attaches, _ := messageData["attaches"].([]interface{})
+	seen := make(map[string]bool)
+	for i, attach := range attaches {
+		attachMap, _ := attach.(map[string]interface{})
+		typed, ok := decodeAttach(attachMap)
+		if !ok {
+			continue
+		}
+		name := attachFileName(typed)
+		if name == "" {
+			continue
+		}
+		// Одинаковые имена файлов в одном сообщении различаются номером вложения
+		if seen[name] {
+			name = fmt.Sprintf("%d_%s", i, name)
+		}
+		seen[name] = true
+
+		job := archiveJob{
+			request: DownloadRequest{Attach: typed, ChatID: chatID, MessageID: messageData["id"]},
+			manifest: ArchiveManifest{
+				ChatID:    chatID,
+				MessageID: messageData["id"],
+				Sender:    messageData["sender"],
+				Time:      messageData["time"],
+				Type:      strings.ToLower(typed.AttachType()),
+				Name:      name,
+				Attach:    typed,
+			},
+		}
+		select {
+		case c.archiver.jobs <- job:
+		default:
+			c.logger.Warn("archive queue is full", "chat_id", chatID, "name", name)
+		}
+	}
+}
+
+// isWatched проверяет, входит ли чат в WatchChats
+func (c *ChatClient) isWatched(chatID interface{}) bool {
+	return containsID(c.WatchChats, chatID)
+}
+
+// expand подставляет поля манифеста в шаблон пути
+func (a *mediaArchiver) expand(m ArchiveManifest) string {
+	date := "unknown"
+	if ms, ok := m.Time.(float64); ok {
+		date = time.UnixMilli(int64(ms)).Format("2006-01-02")
+	}
+	replacer := strings.NewReplacer(
+		"{chat}", safePathPart(idString(m.ChatID)),
+		"{date}", date,
+		"{id}", safePathPart(idString(m.MessageID)),
+		"{sender}", safePathPart(idString(m.Sender)),
+		"{type}", m.Type,
+		"{name}", safePathPart(m.Name),
+	)
+	return filepath.FromSlash(replacer.Replace(a.template))
+}
+
+// attachFileName возвращает имя файла для вложения; пустая строка, если
+// вложение не сохраняется (стикеры, контакты, клавиатуры и т. п.)
+func attachFileName(a Attachment) string {
+	switch v := a.(type) {
+	case Photo:
+		return fmt.Sprintf("photo_%d.jpg", v.PhotoID)
+	case Video:
+		return fmt.Sprintf("video_%d.mp4", v.VideoID)
+	case Audio:
+		return fmt.Sprintf("voice_%d.ogg", v.AudioID)
+	case File:
+		if v.Name != "" {
+			return v.Name
+		}
+		return fmt.Sprintf("file_%d", v.FileID)
+	default:
+		return ""
+	}
+}
+
+// safePathPart не дает значениям из сообщений выйти за пределы каталога архива
+func safePathPart(s string) string {
+	s = strings.NewReplacer("/", "_", "\\", "_", "\x00", "").Replace(s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package maxclientapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestArchiveDuplicateNames(t *testing.T) {
+	var hits int32
+	content := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		io.WriteString(w, "body of "+r.URL.Path)
+	}))
+	defer content.Close()
+
+	server := newTestServer(t)
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		payload, _ := frame["payload"].(map[string]interface{})
+		frame["cmd"] = 1
+		frame["payload"] = map[string]interface{}{}
+		if frame["opcode"].(float64) == 88 {
+			frame["payload"] = map[string]interface{}{"url": content.URL + "/" + idString(payload["fileId"])}
+		}
+		return frame
+	}
+	dir := t.TempDir()
+	c := server.client(WithMediaArchive(dir, ""))
+	c.WatchChats = []string{"1"}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	message := func(id int, files ...map[string]interface{}) map[string]interface{} {
+		attaches := make([]interface{}, 0, len(files))
+		for _, file := range files {
+			attaches = append(attaches, file)
+		}
+		return map[string]interface{}{"ver": 11, "cmd": 0, "seq": 0, "opcode": 128, "payload": map[string]interface{}{
+			"chatId":  1,
+			"message": map[string]interface{}{"id": id, "sender": 2, "attaches": attaches},
+		}}
+	}
+	report := func(id int) map[string]interface{} {
+		return map[string]interface{}{"_type": "FILE", "fileId": id, "name": "report.pdf"}
+	}
+	waitFile := func(path string) []byte {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(path + ".json"); err == nil {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s is not archived", path)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	album := message(5, report(7), report(8))
+	server.push(album)
+	base := filepath.Join(dir, "1", "unknown")
+	if data := waitFile(filepath.Join(base, "5_report.pdf")); string(data) != "body of /7" {
+		t.Fatalf("first file = %q", data)
+	}
+	if data := waitFile(filepath.Join(base, "5_1_report.pdf")); string(data) != "body of /8" {
+		t.Fatalf("second file = %q", data)
+	}
+
+	// Повторная доставка не скачивает файлы заново; следующее сообщение служит меткой
+	server.push(album)
+	server.push(message(6, report(9)))
+	waitFile(filepath.Join(base, "6_report.pdf"))
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Fatalf("downloads = %d, want 3", n)
+	}
+}
@@ -0,0 +1,244 @@
+package maxclientapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Attachment описывает типизированное вложение сообщения
+type Attachment interface {
+	// AttachType возвращает значение поля _type (например, "STICKER")
+	AttachType() string
+}
+
+// Photo описывает вложение PHOTO
+type Photo struct {
+	PhotoID     int64  `json:"photoId"`
+	BaseURL     string `json:"baseUrl"`
+	PhotoToken  string `json:"photoToken,omitempty"`
+	PreviewData string `json:"previewData,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+func (Photo) AttachType() string { return "PHOTO" }
+
+// Video описывает вложение VIDEO. Duration указывается в миллисекундах
+type Video struct {
+	VideoID   int64  `json:"videoId"`
+	Token     string `json:"token,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Duration  int64  `json:"duration,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+func (Video) AttachType() string { return "VIDEO" }
+
+// File описывает вложение FILE
+type File struct {
+	FileID int64  `json:"fileId"`
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+func (File) AttachType() string { return "FILE" }
+
+// Audio описывает вложение AUDIO (голосовое сообщение). Duration указывается в миллисекундах
+type Audio struct {
+	AudioID  int64  `json:"audioId"`
+	Duration int64  `json:"duration,omitempty"`
+	Wave     string `json:"wave,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+func (Audio) AttachType() string { return "AUDIO" }
+
+// Waveform возвращает декодированную форму волны голосового сообщения
+func (a Audio) Waveform() []byte {
+	return decodeWaveform(a.Wave)
+}
+
+// Share описывает вложение SHARE (превью ссылки)
+type Share struct {
+	ShareID     int64  `json:"shareId,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (Share) AttachType() string { return "SHARE" }
+
+// UnknownAttach хранит вложение, тип которого библиотека пока не разбирает
+type UnknownAttach struct {
+	Type string
+	Raw  map[string]interface{}
+}
+
+func (u UnknownAttach) AttachType() string { return u.Type }
+
+// Sticker описывает вложение STICKER
+type Sticker struct {
+	StickerID   int64  `json:"stickerId"`
+	SetID       int64  `json:"setId,omitempty"`
+	URL         string `json:"url,omitempty"`
+	LottieURL   string `json:"lottieUrl,omitempty"`
+	StickerType string `json:"stickerType,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+func (Sticker) AttachType() string { return "STICKER" }
+
+// Contact описывает вложение CONTACT (карточка контакта)
+type Contact struct {
+	ContactID int64  `json:"contactId,omitempty"`
+	Name      string `json:"name,omitempty"`
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	PhotoURL  string `json:"photoUrl,omitempty"`
+	VCFBody   string `json:"vcfBody,omitempty"`
+}
+
+func (Contact) AttachType() string { return "CONTACT" }
+
+// Location описывает вложение LOCATION
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Zoom      int     `json:"zoom,omitempty"`
+}
+
+func (Location) AttachType() string { return "LOCATION" }
+
+// decodeAttach преобразует вложение из JSON в типизированную структуру.
+// Вложения неизвестного типа или с полями неожиданного типа возвращаются как UnknownAttach
+func decodeAttach(attach map[string]interface{}) (Attachment, bool) {
+	mediaType, _ := attach["_type"].(string)
+
+	var result Attachment
+	var err error
+	switch mediaType {
+	case "PHOTO":
+		var v Photo
+		err = decodeMap(attach, &v)
+		result = v
+	case "VIDEO":
+		var v Video
+		err = decodeMap(attach, &v)
+		result = v
+	case "FILE":
+		var v File
+		err = decodeMap(attach, &v)
+		result = v
+	case "AUDIO":
+		var v Audio
+		err = decodeMap(attach, &v)
+		result = v
+	case "SHARE":
+		var v Share
+		err = decodeMap(attach, &v)
+		result = v
+	case "STICKER":
+		var v Sticker
+		err = decodeMap(attach, &v)
+		result = v
+	case "CONTACT":
+		var v Contact
+		err = decodeMap(attach, &v)
+		result = v
+	case "LOCATION":
+		var v Location
+		err = decodeMap(attach, &v)
+		result = v
+	case "INLINE_KEYBOARD":
+		var v InlineKeyboard
+		err = decodeMap(attach, &v)
+		v.normalize()
+		result = v
+	case "":
+		return nil, false
+	default:
+		return UnknownAttach{Type: mediaType, Raw: attach}, true
+	}
+	if err != nil {
+		// Неожиданный формат известного типа: вложение не должно пропадать из сообщения
+		return UnknownAttach{Type: mediaType, Raw: attach}, true
+	}
+	return result, true
+}
+
+// encodeAttach преобразует типизированное вложение в JSON для отправки
+func encodeAttach(a Attachment) (map[string]interface{}, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	attach := map[string]interface{}{}
+	if err := json.Unmarshal(data, &attach); err != nil {
+		return nil, err
+	}
+	attach["_type"] = a.AttachType()
+	return attach, nil
+}
+
+// decodeMap раскладывает разобранный JSON объект в структуру
+func decodeMap(m map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// handleTypedAttach обрабатывает вложения, для которых есть типизированная структура
+func (c *ChatClient) handleTypedAttach(attach map[string]interface{}, chatID, sender interface{}, text string, messageData, payload map[string]interface{}) {
+	typed, ok := decodeAttach(attach)
+	if !ok {
+		return
+	}
+
+	mediaInfo := map[string]interface{}{
+		"opcode":        128,
+		"type":          strings.ToLower(typed.AttachType()),
+		"chat_id":       chatID,
+		"sender":        sender,
+		"attach":        typed,
+		"raw":           attach,
+		"id":            messageData["id"],
+		"time":          messageData["time"],
+		"utype":         messageData["type"],
+		"prevMessageId": payload["prevMessageId"],
+	}
+	if text != "" {
+		mediaInfo["text"] = text
+	}
+	c.emit(mediaInfo)
+}
+
+// SendSticker отправляет стикер по его идентификатору
+func (c *ChatClient) SendSticker(chatID interface{}, stickerID int64) error {
+	return c.sendAttachment(chatID, "", Sticker{StickerID: stickerID}, "Sticker")
+}
+
+// SendContact отправляет карточку контакта
+func (c *ChatClient) SendContact(chatID interface{}, contact Contact) error {
+	return c.sendAttachment(chatID, "", contact, "Contact")
+}
+
+// SendLocation отправляет геопозицию
+func (c *ChatClient) SendLocation(chatID interface{}, latitude, longitude float64) error {
+	return c.sendAttachment(chatID, "", Location{Latitude: latitude, Longitude: longitude, Zoom: 15}, "Location")
+}
+
+// sendAttachment отправляет одно типизированное вложение
+func (c *ChatClient) sendAttachment(chatID interface{}, text string, a Attachment, sendType string) error {
+	attach, err := encodeAttach(a)
+	if err != nil {
+		return err
+	}
+	return c.sendAttaches(chatID, text, []interface{}{attach}, sendType)
+}
@@ -0,0 +1,66 @@
+package maxclientapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeAttachMismatchIsKept(t *testing.T) {
+	raw := map[string]interface{}{"_type": "PHOTO", "photoId": "not a number", "baseUrl": "https://i/1"}
+	got, ok := decodeAttach(raw)
+	if !ok {
+		t.Fatal("attach with a type mismatch is dropped")
+	}
+	unknown, isUnknown := got.(UnknownAttach)
+	if !isUnknown || unknown.Type != "PHOTO" || !reflect.DeepEqual(unknown.Raw, raw) {
+		t.Fatalf("got %#v, want UnknownAttach with the raw attach", got)
+	}
+
+	if _, ok := decodeAttach(map[string]interface{}{"photoId": 1}); ok {
+		t.Fatal("attach without _type is decoded")
+	}
+}
+
+func TestAlbumIsOneEvent(t *testing.T) {
+	c := NewChatClient("token", "device")
+	c.handleOpcode128(map[string]interface{}{
+		"opcode": 128.0,
+		"payload": map[string]interface{}{
+			"chatId": 1.0,
+			"message": map[string]interface{}{
+				"id":     100.0,
+				"sender": 2.0,
+				"text":   "album caption",
+				"attaches": []interface{}{
+					map[string]interface{}{"_type": "PHOTO", "photoId": 1.0, "baseUrl": "https://i/1"},
+					map[string]interface{}{"_type": "PHOTO", "photoId": 2.0, "baseUrl": "https://i/2"},
+					map[string]interface{}{"_type": "PHOTO", "photoId": "broken"},
+					map[string]interface{}{"_type": "PHOTO", "photoId": 4.0, "baseUrl": "https://i/4"},
+				},
+			},
+		},
+	})
+
+	if depth := c.QueueDepth(); depth != 1 {
+		t.Fatalf("got %d events, want 1", depth)
+	}
+	event, _ := c.GetMessage()
+	if event["type"] != "message" || event["text"] != "album caption" {
+		t.Fatalf("event = %v", event)
+	}
+	attaches, _ := event["attaches"].([]Attachment)
+	if len(attaches) != 4 {
+		t.Fatalf("got %d attaches, want 4", len(attaches))
+	}
+	for i, id := range []int64{1, 2, 0, 4} {
+		if id == 0 {
+			if _, ok := attaches[i].(UnknownAttach); !ok {
+				t.Errorf("attach %d = %#v, want UnknownAttach", i, attaches[i])
+			}
+			continue
+		}
+		if photo, ok := attaches[i].(Photo); !ok || photo.PhotoID != id {
+			t.Errorf("attach %d = %#v, want photo %d", i, attaches[i], id)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package maxclientapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UploadCache запоминает ответы сервера на загрузку (photoToken, fileId, videoId)
+// по хешу содержимого, чтобы не загружать один и тот же файл повторно.
+// Если задан путь, кэш сохраняется на диск после каждого изменения
+type UploadCache struct {
+	path    string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]uploadCacheEntry
+}
+
+type uploadCacheEntry struct {
+	Attach  map[string]interface{} `json:"attach"`
+	Created time.Time              `json:"created"`
+}
+
+// NewUploadCache создает кэш загрузок. Пустой path означает кэш только в памяти,
+// ttl <= 0 — записи не устаревают
+func NewUploadCache(path string, ttl time.Duration) (*UploadCache, error) {
+	cache := &UploadCache{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]uploadCacheEntry),
+	}
+	if path == "" {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// WithUploadCache включает повторное использование загруженных вложений
+func WithUploadCache(cache *UploadCache) Option {
+	return func(c *ChatClient) {
+		c.uploadCache = cache
+	}
+}
+
+// Get возвращает сохраненное вложение, если запись есть и не устарела
+func (u *UploadCache) Get(key string) (map[string]interface{}, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, ok := u.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if u.ttl > 0 && time.Since(entry.Created) > u.ttl {
+		delete(u.entries, key)
+		return nil, false
+	}
+	return entry.Attach, true
+}
+
+// Put сохраняет вложение и записывает кэш на диск
+func (u *UploadCache) Put(key string, attach map[string]interface{}) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.entries[key] = uploadCacheEntry{Attach: attach, Created: time.Now()}
+	return u.save()
+}
+
+// Delete удаляет запись, например после того как сервер отклонил токен
+func (u *UploadCache) Delete(key string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	delete(u.entries, key)
+	return u.save()
+}
+
+// save записывает кэш через временный файл, чтобы не повредить его при сбое
+func (u *UploadCache) save() error {
+	if u.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(u.entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(u.path), ".upload-cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), u.path)
+}
+
+// uploadCacheKey строит ключ из вида вложения, хеша содержимого и опций,
+// влияющих на загружаемые данные или на вложение: имени файла, длительности,
+// размеров видео и удаления метаданных
+func uploadCacheKey(kind string, data []byte, o *sendOptions) string {
+	sum := sha256.Sum256(data)
+	key := kind + ":" + hex.EncodeToString(sum[:]) + ":name=" + strconv.Quote(o.name)
+	if o.duration > 0 {
+		key += ":duration=" + strconv.FormatInt(o.duration.Milliseconds(), 10)
+	}
+	if o.width > 0 && o.height > 0 {
+		key += fmt.Sprintf(":size=%dx%d", o.width, o.height)
+	}
+	if o.stripMetadata {
+		key += ":stripped"
+		if o.keepOrientation {
+			key += ":orientation"
+		}
+	}
+	return key
+}
@@ -0,0 +1,39 @@
+package maxclientapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadCacheKeyOptions(t *testing.T) {
+	data := []byte("same content")
+	base := uploadCacheKey(KindVideo, data, newSendOptions("video.mp4", nil))
+	if got := uploadCacheKey(KindVideo, data, newSendOptions("video.mp4", nil)); got != base {
+		t.Fatalf("key is not stable: %s != %s", got, base)
+	}
+
+	options := map[string][]SendOption{
+		"name":        {WithFileName("other.mp4")},
+		"duration":    {WithDuration(3 * time.Second)},
+		"dimensions":  {WithDimensions(1280, 720)},
+		"strip":       {WithStripMetadata(false)},
+		"orientation": {WithStripMetadata(true)},
+	}
+	seen := map[string]string{base: "defaults"}
+	for name, opts := range options {
+		key := uploadCacheKey(KindVideo, data, newSendOptions("video.mp4", opts))
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s share the key %s", name, other, key)
+		}
+		seen[key] = name
+	}
+
+	// Прогресс и разбиение на части не меняют загруженное вложение
+	same := newSendOptions("video.mp4", []SendOption{WithProgress(func(Progress) {}), WithSplitParts(100)})
+	if got := uploadCacheKey(KindVideo, data, same); got != base {
+		t.Errorf("progress and split options change the key: %s", got)
+	}
+	if uploadCacheKey(KindFile, data, newSendOptions("video.mp4", nil)) == base {
+		t.Error("kind is not part of the key")
+	}
+}
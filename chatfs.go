@@ -0,0 +1,365 @@
+package maxclientapi
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FetchHistory запрашивает до count сообщений чата, отправленных раньше from
+// (время в миллисекундах, 0 — с текущего момента). Сообщения возвращаются от старых к новым
+func (c *ChatClient) FetchHistory(chatID interface{}, from int64, count int) ([]map[string]interface{}, error) {
+	if from == 0 {
+		from = time.Now().UnixMilli()
+	}
+	reply, err := c.request(49, map[string]interface{}{
+		"chatId":      chatID,
+		"from":        from,
+		"forward":     0,
+		"backward":    count,
+		"getMessages": true,
+	}, "Chat history")
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := reply["messages"].([]interface{})
+	messages := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if message, ok := item.(map[string]interface{}); ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// ChatFS возвращает доступную только для чтения файловую систему с вложениями чатов:
+// <chat>/<YYYY-MM-DD>/<messageId>_<name>. История загружается при первом обращении
+// к каталогу чата (не более historyLimit сообщений), файл скачивается во временный файл
+// при первом чтении. Размер фото, видео и голосовых сообщений неизвестен до скачивания,
+// поэтому в листинге и Stat он равен 0. Подходит для http.FileServer(http.FS(...)) и fs.WalkDir
+func (c *ChatClient) ChatFS(historyLimit int, chatIDs ...interface{}) fs.FS {
+	chats := make([]string, 0, len(chatIDs))
+	ids := make(map[string]interface{}, len(chatIDs))
+	for _, chatID := range chatIDs {
+		name := idString(chatID)
+		chats = append(chats, name)
+		ids[name] = chatID
+	}
+	sort.Strings(chats)
+
+	return &chatFS{
+		client:       c,
+		downloader:   c.NewDownloader(),
+		historyLimit: historyLimit,
+		chats:        chats,
+		chatIDs:      ids,
+		index:        make(map[string]map[string][]chatFSEntry),
+		loading:      make(map[string]chan struct{}),
+	}
+}
+
+type chatFS struct {
+	client       *ChatClient
+	downloader   *Downloader
+	historyLimit int
+	chats        []string
+	chatIDs      map[string]interface{}
+
+	mu      sync.Mutex
+	index   map[string]map[string][]chatFSEntry // чат -> дата -> файлы; после загрузки не меняется
+	loading map[string]chan struct{}            // закрывается, когда загрузка истории чата завершена
+}
+
+type chatFSEntry struct {
+	info    fileInfo
+	request DownloadRequest
+}
+
+func (f *chatFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		entries := make([]fs.DirEntry, 0, len(f.chats))
+		for _, chat := range f.chats {
+			entries = append(entries, fileInfo{name: chat, isDir: true})
+		}
+		return &dirFile{info: fileInfo{name: ".", isDir: true}, entries: entries}, nil
+	}
+
+	parts := strings.Split(name, "/")
+	if _, ok := f.chatIDs[parts[0]]; !ok || len(parts) > 3 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	dates, err := f.load(parts[0])
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	switch len(parts) {
+	case 1:
+		entries := make([]fs.DirEntry, 0, len(dates))
+		for date := range dates {
+			entries = append(entries, fileInfo{name: date, isDir: true})
+		}
+		sortEntries(entries)
+		return &dirFile{info: fileInfo{name: parts[0], isDir: true}, entries: entries}, nil
+	case 2:
+		files, ok := dates[parts[1]]
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		entries := make([]fs.DirEntry, 0, len(files))
+		for _, file := range files {
+			entries = append(entries, file.info)
+		}
+		return &dirFile{info: fileInfo{name: parts[1], isDir: true}, entries: entries}, nil
+	default:
+		for _, file := range dates[parts[1]] {
+			if file.info.name == parts[2] {
+				return &attachFile{entry: file, downloader: f.downloader, path: name}, nil
+			}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+}
+
+// load возвращает индекс вложений чата по датам, загружая историю при первом обращении.
+// Запросы истории выполняются без f.mu; параллельные вызовы ждут одну загрузку
+func (f *chatFS) load(chat string) (map[string][]chatFSEntry, error) {
+	for {
+		f.mu.Lock()
+		if dates, ok := f.index[chat]; ok {
+			f.mu.Unlock()
+			return dates, nil
+		}
+		if wait, ok := f.loading[chat]; ok {
+			f.mu.Unlock()
+			// После ошибки загрузки следующий вызов пробует снова
+			<-wait
+			continue
+		}
+		wait := make(chan struct{})
+		f.loading[chat] = wait
+		f.mu.Unlock()
+
+		dates, err := f.fetchIndex(chat)
+
+		f.mu.Lock()
+		delete(f.loading, chat)
+		if err == nil {
+			f.index[chat] = dates
+		}
+		f.mu.Unlock()
+		close(wait)
+		return dates, err
+	}
+}
+
+// fetchIndex загружает до historyLimit сообщений истории чата и строит индекс вложений
+func (f *chatFS) fetchIndex(chat string) (map[string][]chatFSEntry, error) {
+	chatID := f.chatIDs[chat]
+	dates := make(map[string][]chatFSEntry)
+	seen := make(map[string]bool)
+	var from int64
+	for loaded := 0; loaded < f.historyLimit; {
+		page := f.historyLimit - loaded
+		if page > 100 {
+			page = 100
+		}
+		messages, err := f.client.FetchHistory(chatID, from, page)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		loaded += len(messages)
+
+		oldest := from
+		for _, message := range messages {
+			ms, _ := message["time"].(float64)
+			if oldest == 0 || int64(ms) < oldest {
+				oldest = int64(ms)
+			}
+			f.indexMessage(dates, seen, chatID, message)
+		}
+		if oldest >= from && from != 0 {
+			break
+		}
+		from = oldest - 1
+	}
+
+	for date := range dates {
+		sort.Slice(dates[date], func(i, j int) bool {
+			return dates[date][i].info.name < dates[date][j].info.name
+		})
+	}
+	return dates, nil
+}
+
+func (f *chatFS) indexMessage(dates map[string][]chatFSEntry, seen map[string]bool, chatID interface{}, message map[string]interface{}) {
+	ms, _ := message["time"].(float64)
+	modTime := time.UnixMilli(int64(ms))
+	date := modTime.Format("2006-01-02")
+
+	attaches, _ := message["attaches"].([]interface{})
+	for i, attach := range attaches {
+		attachMap, _ := attach.(map[string]interface{})
+		typed, ok := decodeAttach(attachMap)
+		if !ok {
+			continue
+		}
+		attachName := attachFileName(typed)
+		if attachName == "" {
+			continue
+		}
+
+		name := safePathPart(idString(message["id"]) + "_" + attachName)
+		if seen[date+"/"+name] {
+			name = safePathPart(fmt.Sprintf("%s_%d_%s", idString(message["id"]), i, attachName))
+		}
+		seen[date+"/"+name] = true
+
+		var size int64
+		if file, ok := typed.(File); ok {
+			size = file.Size
+		}
+		dates[date] = append(dates[date], chatFSEntry{
+			info: fileInfo{name: name, size: size, modTime: modTime},
+			request: DownloadRequest{
+				Attach:    typed,
+				ChatID:    chatID,
+				MessageID: message["id"],
+			},
+		})
+	}
+}
+
+func sortEntries(entries []fs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+}
+
+// fileInfo реализует fs.FileInfo и fs.DirEntry
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return i.isDir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (i fileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// attachFile — вложение, которое скачивается во временный файл при первом Read или Seek.
+// Seek нужен http.FileServer
+type attachFile struct {
+	entry      chatFSEntry
+	downloader *Downloader
+	path       string
+
+	file *os.File
+	err  error
+}
+
+func (f *attachFile) Stat() (fs.FileInfo, error) { return f.entry.info, nil }
+
+func (f *attachFile) Read(b []byte) (int, error) {
+	if err := f.fetch(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(b)
+}
+
+func (f *attachFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.fetch(); err != nil {
+		return 0, err
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *attachFile) Close() error {
+	f.err = &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	os.Remove(f.file.Name())
+	f.file = nil
+	return err
+}
+
+// fetch скачивает вложение во временный файл, не держа его в памяти
+func (f *attachFile) fetch() error {
+	if f.err != nil || f.file != nil {
+		return f.err
+	}
+	file, err := os.CreateTemp("", "maxclientapi-chatfs-*")
+	if err == nil {
+		_, err = f.downloader.Download(f.entry.request, file)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		f.err = &fs.PathError{Op: "read", Path: f.path, Err: err}
+		return f.err
+	}
+	f.file = file
+	return nil
+}
+
+// dirFile реализует fs.ReadDirFile
+type dirFile struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
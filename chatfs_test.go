@@ -0,0 +1,131 @@
+package maxclientapi
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestChatFS(t *testing.T) {
+	files := map[string]string{
+		"/photo/5":  "jpeg bytes of photo 5",
+		"/file/7":   "quarterly report",
+		"/file/8":   "nested name",
+		"/video/9":  "mp4 bytes",
+		"/voice/12": "ogg bytes",
+	}
+	content := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer content.Close()
+
+	day1 := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local).UnixMilli()
+	day2 := time.Date(2024, 1, 3, 12, 0, 0, 0, time.Local).UnixMilli()
+	messages := []interface{}{
+		map[string]interface{}{"id": 10, "time": day1, "attaches": []interface{}{
+			map[string]interface{}{"_type": "PHOTO", "photoId": 5, "baseUrl": content.URL + "/photo/5?fn=sqr_288"},
+			map[string]interface{}{"_type": "FILE", "fileId": 7, "name": "report.txt", "size": len(files["/file/7"])},
+		}},
+		map[string]interface{}{"id": 11, "time": day2, "attaches": []interface{}{
+			map[string]interface{}{"_type": "FILE", "fileId": 8, "name": "a/b.txt", "size": len(files["/file/8"])},
+			map[string]interface{}{"_type": "VIDEO", "videoId": 9},
+			map[string]interface{}{"_type": "AUDIO", "audioId": 12, "url": content.URL + "/voice/12"},
+		}},
+	}
+
+	server := newTestServer(t)
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		payload, _ := frame["payload"].(map[string]interface{})
+		frame["cmd"] = 1
+		switch frame["opcode"].(float64) {
+		case 49:
+			switch {
+			case payload["chatId"].(float64) == 3:
+				// История этого чата не приходит никогда
+				return nil
+			case payload["chatId"].(float64) == 1 && int64(payload["from"].(float64)) > day2:
+				frame["payload"] = map[string]interface{}{"messages": messages}
+			default:
+				frame["payload"] = map[string]interface{}{"messages": []interface{}{}}
+			}
+		case 83:
+			frame["payload"] = map[string]interface{}{"MP4_720": content.URL + "/video/9"}
+		case 88:
+			frame["payload"] = map[string]interface{}{"url": content.URL + "/file/" + idString(payload["fileId"])}
+		default:
+			frame["payload"] = map[string]interface{}{}
+		}
+		return frame
+	}
+	c := server.client(WithRequestTimeout(2 * time.Second))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	fsys := c.ChatFS(100, 1, 2, 3)
+
+	// Загрузка истории одного чата не блокирует другие
+	go fsys.Open("3")
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := fs.ReadDir(fsys, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("chat 1 waited for chat 3 history")
+	}
+
+	want := []string{
+		"1/2024-01-02/10_photo_5.jpg",
+		"1/2024-01-02/10_report.txt",
+		"1/2024-01-03/11_a_b.txt",
+		"1/2024-01-03/11_video_9.mp4",
+		"1/2024-01-03/11_voice_12.ogg",
+	}
+	sub, err := fs.Sub(fsys, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, name := range want {
+		expected = append(expected, strings.TrimPrefix(name, "1/"))
+	}
+	if err := fstest.TestFS(sub, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{
+		"1/2024-01-02/10_photo_5.jpg":  "/photo/5",
+		"1/2024-01-02/10_report.txt":   "/file/7",
+		"1/2024-01-03/11_video_9.mp4":  "/video/9",
+		"1/2024-01-03/11_voice_12.ogg": "/voice/12",
+	} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != files[path] {
+			t.Errorf("%s = %q, want %q", name, data, files[path])
+		}
+	}
+
+	info, err := fs.Stat(fsys, "1/2024-01-02/10_report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(files["/file/7"])) {
+		t.Errorf("size = %d, want %d", info.Size(), len(files["/file/7"]))
+	}
+}
@@ -0,0 +1,132 @@
+package maxclientapi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed возвращается при попытке подключить клиент после Close
+var ErrClosed = errors.New("maxclientapi: client is closed")
+
+// Close корректно завершает работу клиента: дожидается отправки кадров из очереди,
+// отправляет WebSocket close, останавливает фоновые горутины и закрывает канал событий.
+// Если ctx истекает раньше, соединение закрывается принудительно и возвращается ctx.Err().
+// Повторный вызов ждет завершения первого
+func (c *ChatClient) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		done := c.done
+		c.mu.Unlock()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.closed = true
+	close(c.closing)
+	stopOnce, stop := c.stopOnce, c.stopChan
+	stopOnce.Do(func() {
+		close(stop)
+	})
+	cn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	var err error
+	if cn != nil {
+		err = c.closeConnection(ctx, cn)
+	}
+	c.setState(StateClosed)
+
+	// Канал событий закрывается только после остановки всех горутин, которые в него пишут
+	finished := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(c.messages)
+		c.mu.Lock()
+		spill := c.spill
+		c.mu.Unlock()
+		if spill != nil {
+			spill.close()
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.finish(err)
+	return err
+}
+
+// closeConnection отправляет close после всех кадров из очереди и ждет, пока сервер закроет соединение.
+// Полуоткрытое соединение может не ответить никогда, поэтому после отправки close
+// ожидание ограничено closeTimeout, затем соединение закрывается принудительно
+func (c *ChatClient) closeConnection(ctx context.Context, cn *connection) error {
+	defer cn.close()
+
+	out := &outgoing{closeFrame: true, result: make(chan error, 1)}
+	select {
+	case cn.outbox <- out:
+	case <-cn.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(c.closeTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-out.result:
+		if err != nil {
+			return nil
+		}
+	case <-cn.done:
+		return nil
+	case <-timer.C:
+		c.logger.Warn("close frame is not written, closing connection")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// listenHandler закроет соединение, получив ответный close
+	select {
+	case <-cn.done:
+		return nil
+	case <-timer.C:
+		c.logger.Warn("server did not answer close, closing connection")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait блокируется до завершения работы клиента (Close, Stop или разрыв соединения
+// без переподключения) и возвращает ошибку, с которой оно завершилось
+func (c *ChatClient) Wait() error {
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.doneErr
+}
+
+// finish отмечает завершение работы клиента с ошибкой err
+func (c *ChatClient) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		c.doneErr = err
+		close(c.done)
+	}
+}
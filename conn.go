@@ -0,0 +1,285 @@
+package maxclientapi
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connection — одно WebSocket соединение. Писать в ws может только writeHandler,
+// читать — только listenHandler; остальные горутины общаются с ними через каналы
+type connection struct {
+	ws        *websocket.Conn
+	outbox    chan *outgoing
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// outgoing — кадр, ожидающий отправки
+type outgoing struct {
+	opcode   int
+	payload  map[string]interface{}
+	sendType string
+	// closeFrame — вместо кадра протокола отправить WebSocket close
+	closeFrame bool
+	// onSeq вызывается с присвоенным seq до записи в сокет, чтобы ответ нельзя было получить раньше регистрации
+	onSeq  func(seq int)
+	result chan error
+}
+
+func newConnection(ws *websocket.Conn) *connection {
+	return &connection{
+		ws:     ws,
+		outbox: make(chan *outgoing, 64),
+		done:   make(chan struct{}),
+	}
+}
+
+// close закрывает соединение; повторные вызовы ничего не делают
+func (cn *connection) close() {
+	cn.closeOnce.Do(func() {
+		close(cn.done)
+		cn.ws.Close()
+	})
+}
+
+// closed сообщает, закрыто ли соединение
+func (cn *connection) closed() bool {
+	select {
+	case <-cn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeHandler — единственная горутина, которая пишет в сокет соединения cn
+func (c *ChatClient) writeHandler(cn *connection) {
+	pings, stopPings := c.pingTicker()
+	defer stopPings()
+
+	for {
+		select {
+		case out := <-cn.outbox:
+			out.result <- c.write(cn, out)
+		case <-pings:
+			if err := c.writePing(cn); err != nil && !cn.closed() {
+				c.logger.Error("websocket ping failed", "err", err)
+				cn.close()
+			}
+		case <-cn.done:
+			return
+		}
+	}
+}
+
+// write присваивает кадру seq и записывает его в сокет
+func (c *ChatClient) write(cn *connection, out *outgoing) error {
+	if out.closeFrame {
+		return cn.ws.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+
+	seq := int(atomic.AddInt64(&c.seq, 1))
+	data := map[string]interface{}{
+		"ver":     11,
+		"cmd":     0,
+		"seq":     seq,
+		"opcode":  out.opcode,
+		"payload": out.payload,
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		c.logger.Error("marshal failed", "opcode", out.opcode, "seq", seq, "err", err)
+		return err
+	}
+	if out.onSeq != nil {
+		out.onSeq(seq)
+	}
+
+	err = cn.ws.WriteMessage(websocket.TextMessage, jsonData)
+	if err != nil {
+		c.logger.Error("write failed", "opcode", out.opcode, "seq", seq, "err", err)
+		cn.close()
+		return err
+	}
+	atomic.AddUint64(&c.framesOut, 1)
+	atomic.AddUint64(&c.bytesOut, uint64(len(jsonData)))
+	c.opcodeStats.countOut(out.opcode)
+
+	if c.debug {
+		c.logger.Debug("frame sent", "opcode", out.opcode, "seq", seq, "type", out.sendType, "data", c.redact(jsonData))
+	} else if out.sendType != "" {
+		c.logger.Debug("frame sent", "opcode", out.opcode, "seq", seq, "type", out.sendType)
+	}
+	return nil
+}
+
+// send отправляет кадр через WebSocket и ждет, пока он будет записан
+func (c *ChatClient) send(opcode int, payload map[string]interface{}, sendType string) error {
+	return c.sendWithSeq(opcode, payload, sendType, nil)
+}
+
+// sendWithSeq отправляет кадр, сообщая присвоенный ему seq через onSeq
+func (c *ChatClient) sendWithSeq(opcode int, payload map[string]interface{}, sendType string, onSeq func(seq int)) error {
+	out := &outgoing{
+		opcode:   opcode,
+		payload:  payload,
+		sendType: sendType,
+		onSeq:    onSeq,
+		result:   make(chan error, 1),
+	}
+	cn, err := c.enqueue(out)
+	if err == nil {
+		select {
+		case err = <-out.result:
+		case <-cn.done:
+			err = ErrNotConnected
+		}
+	}
+	if err != nil {
+		c.opcodeStats.countError(err)
+	}
+	return err
+}
+
+// enqueue передает кадр в очередь отправки текущего соединения
+func (c *ChatClient) enqueue(out *outgoing) (*connection, error) {
+	cn := c.currentConnection()
+	if cn == nil {
+		c.logger.Warn("websocket is not connected", "opcode", out.opcode)
+		return nil, ErrNotConnected
+	}
+	select {
+	case cn.outbox <- out:
+		return cn, nil
+	case <-cn.done:
+		return nil, ErrNotConnected
+	}
+}
+
+func (c *ChatClient) currentConnection() *connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// isConnected сообщает, есть ли открытое соединение
+func (c *ChatClient) isConnected() bool {
+	return c.currentConnection() != nil
+}
+
+// stopped возвращает канал, который закрывается при Stop
+func (c *ChatClient) stopped() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopChan
+}
+
+// dropConnection закрывает соединение cn после ошибки чтения и,
+// если разрешено, запускает переподключение
+func (c *ChatClient) dropConnection(cn *connection, err error) {
+	cn.close()
+
+	c.mu.Lock()
+	if c.conn != cn {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	stopOnce, stop := c.stopOnce, c.stopChan
+	select {
+	case <-stop:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	if c.allowReconnect {
+		c.spawn(func() { c.reconnect(stop) })
+	}
+	c.mu.Unlock()
+
+	if !c.allowReconnect {
+		// Сессия завершена: keepalive и другие фоновые горутины должны остановиться
+		stopOnce.Do(func() {
+			close(stop)
+		})
+		c.setState(StateClosed)
+		c.finish(err)
+		return
+	}
+	c.setState(StateReconnecting)
+}
+
+// failConnection закрывает соединение cn без переподключения и завершает работу клиента с err
+func (c *ChatClient) failConnection(cn *connection, err error) {
+	cn.close()
+
+	c.mu.Lock()
+	current := c.conn == cn
+	if current {
+		c.conn = nil
+	}
+	stopOnce, stop := c.stopOnce, c.stopChan
+	c.mu.Unlock()
+
+	if current {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+		c.setState(StateClosed)
+		c.finish(err)
+	}
+}
+
+// reconnect пытается восстановить соединение, пока клиент не остановлен
+func (c *ChatClient) reconnect(stop chan struct{}) {
+	delay := c.reconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+		err := c.connect(stop)
+		if err == nil || err == ErrNotConnected {
+			return
+		}
+		c.logger.Warn("reconnect failed", "err", err)
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// Stop останавливает клиент. Повторный вызов безопасен
+func (c *ChatClient) Stop() {
+	c.mu.Lock()
+	cn := c.conn
+	c.conn = nil
+	stopOnce, stop := c.stopOnce, c.stopChan
+	c.mu.Unlock()
+
+	stopOnce.Do(func() {
+		close(stop)
+	})
+	if cn != nil {
+		cn.close()
+	}
+	c.setState(StateClosed)
+	c.finish(nil)
+}
+
+// spawn запускает f в горутине, завершения которой дожидается Close. Вызывать под c.mu
+// после проверки, что клиент не остановлен, или из уже отслеживаемой горутины
+func (c *ChatClient) spawn(f func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		f()
+	}()
+}
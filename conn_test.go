@@ -0,0 +1,284 @@
+package maxclientapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer — WebSocket сервер, отвечающий на каждый кадр cmd 1 с тем же seq
+type testServer struct {
+	*httptest.Server
+
+	// reply позволяет подменить ответ; nil — кадр остается без ответа
+	reply func(frame map[string]interface{}) map[string]interface{}
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	total int64
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := &testServer{}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		atomic.AddInt64(&s.total, 1)
+		s.mu.Lock()
+		s.conns = append(s.conns, ws)
+		s.mu.Unlock()
+
+		for {
+			var frame map[string]interface{}
+			if err := ws.ReadJSON(&frame); err != nil {
+				return
+			}
+			reply := s.answer(frame)
+			if reply == nil {
+				continue
+			}
+			s.mu.Lock()
+			err := ws.WriteJSON(reply)
+			s.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) answer(frame map[string]interface{}) map[string]interface{} {
+	if s.reply != nil {
+		return s.reply(frame)
+	}
+	frame["cmd"] = 1
+	frame["payload"] = map[string]interface{}{}
+	return frame
+}
+
+// dropAll разрывает все соединения со стороны сервера
+func (s *testServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ws := range s.conns {
+		ws.Close()
+	}
+	s.conns = nil
+}
+
+// push отправляет кадр от сервера во все открытые соединения
+func (s *testServer) push(frame map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ws := range s.conns {
+		ws.WriteJSON(frame)
+	}
+}
+
+func (s *testServer) connections() int64 {
+	return atomic.LoadInt64(&s.total)
+}
+
+func (s *testServer) client(options ...Option) *ChatClient {
+	c := NewChatClient("token", "device", options...)
+	c.URL = "ws" + strings.TrimPrefix(s.URL, "http")
+	c.reconnectDelay = 10 * time.Millisecond
+	return c
+}
+
+func waitReady(t *testing.T, c *ChatClient) {
+	t.Helper()
+	select {
+	case <-c.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("client is not ready, state %s", c.State())
+	}
+}
+
+func TestConcurrentSendKeepaliveReconnect(t *testing.T) {
+	server := newTestServer(t)
+	c := server.client(WithAllowReconnect(true))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	c.StartKeepalive(time.Millisecond)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				c.SendMessage(g, "hello")
+				c.GetVideoURL(1, g, i)
+				c.Stats()
+				c.State()
+			}
+		}(g)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		server.dropAll()
+	}
+	wg.Wait()
+
+	// Последний разрыв клиент мог еще не заметить, поэтому запрос повторяется
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		waitReady(t, c)
+		_, err := c.request(49, map[string]interface{}{}, "")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("request after reconnect: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.connections() < 2 {
+		t.Fatalf("connections = %d, want reconnects", server.connections())
+	}
+	if c.Stats().Reconnects == 0 {
+		t.Fatal("reconnects are not counted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepeatedStopConnect(t *testing.T) {
+	server := newTestServer(t)
+	c := server.client()
+	c.StartKeepalive(time.Millisecond)
+
+	for round := 0; round < 5; round++ {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		c.StartKeepalive(time.Millisecond)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					c.SendMessage(1, "hello")
+				}
+			}()
+		}
+		// Stop вызывается несколько раз и параллельно с отправкой
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Millisecond)
+				c.Stop()
+			}()
+		}
+		wg.Wait()
+
+		if c.State() != StateClosed {
+			t.Fatalf("round %d: state %s after Stop", round, c.State())
+		}
+		if err := c.send(1, nil, ""); err != ErrNotConnected {
+			t.Fatalf("round %d: send after Stop: %v", round, err)
+		}
+	}
+}
+
+func TestCloseDuringSends(t *testing.T) {
+	server := newTestServer(t)
+	c := server.client(WithAllowReconnect(true))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	c.StartKeepalive(time.Millisecond)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c.SendMessage(1, "hello")
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	for range c.Messages() {
+	}
+	if err := c.Wait(); err != nil {
+		t.Fatalf("Wait after Close: %v", err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if err := c.Connect(); err != ErrClosed {
+		t.Fatalf("Connect after Close: %v", err)
+	}
+}
+
+func TestCloseHalfOpenConnection(t *testing.T) {
+	server := newTestServer(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		if frame["opcode"].(float64) == 49 {
+			// Сервер перестает читать и не ответит на close
+			<-release
+			return nil
+		}
+		frame["cmd"] = 1
+		frame["payload"] = map[string]interface{}{}
+		return frame
+	}
+	c := server.client()
+	c.closeTimeout = 100 * time.Millisecond
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	c.send(49, map[string]interface{}{}, "")
+
+	done := make(chan error, 1)
+	go func() { done <- c.Close(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Close = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hangs on a half-open connection")
+	}
+	if c.State() != StateClosed {
+		t.Fatalf("state %s after Close", c.State())
+	}
+}
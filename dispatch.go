@@ -0,0 +1,78 @@
+package maxclientapi
+
+import "sync"
+
+// inbox — входящие кадры, ожидающие обработки. listenHandler только добавляет
+// в нее кадры и не ждет потребителя, поэтому ответы на запросы и пинги читаются,
+// даже если очередь сообщений заполнена
+type inbox struct {
+	mu     sync.Mutex
+	frames []map[string]interface{}
+	notify chan struct{}
+	// inflight — кадр взят диспетчером, но его событие еще не в очереди
+	inflight int
+}
+
+func (q *inbox) push(frame map[string]interface{}) {
+	q.mu.Lock()
+	q.frames = append(q.frames, frame)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *inbox) pop() (map[string]interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.frames) == 0 {
+		return nil, false
+	}
+	frame := q.frames[0]
+	q.frames[0] = nil
+	q.frames = q.frames[1:]
+	q.inflight++
+	return frame, true
+}
+
+// handled отмечает, что кадр, полученный из pop, обработан
+func (q *inbox) handled() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inflight--
+}
+
+// len возвращает число необработанных кадров, включая взятый диспетчером
+func (q *inbox) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.frames) + q.inflight
+}
+
+// dispatch передает кадр горутине-диспетчеру, которая превращает кадры в события
+// по одному, сохраняя порядок. Ожидание места в очереди (QueueBlock) происходит в ней
+func (c *ChatClient) dispatch(frame map[string]interface{}) {
+	c.dispatchOnce.Do(func() {
+		c.spawn(c.dispatcher)
+	})
+	c.inbox.push(frame)
+}
+
+func (c *ChatClient) dispatcher() {
+	for {
+		select {
+		case <-c.inbox.notify:
+		case <-c.closing:
+			return
+		}
+		for {
+			frame, ok := c.inbox.pop()
+			if !ok {
+				break
+			}
+			c.handleEvent(frame)
+			c.inbox.handled()
+		}
+	}
+}
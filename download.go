@@ -0,0 +1,362 @@
+package maxclientapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotDownloadable возвращается для вложений, у которых нет файла для скачивания
+var ErrNotDownloadable = errors.New("maxclientapi: attachment has nothing to download")
+
+// ErrSizeMismatch возвращается, если размер скачанного файла не совпал с ожидаемым
+var ErrSizeMismatch = errors.New("maxclientapi: downloaded size mismatch")
+
+// DownloadRequest описывает вложение для скачивания. ChatID и MessageID нужны
+// для видео и файлов: сервер выдает ссылку только в контексте сообщения
+type DownloadRequest struct {
+	Attach    Attachment
+	ChatID    interface{}
+	MessageID interface{}
+}
+
+// DownloadJob описывает одну задачу для DownloadAll
+type DownloadJob struct {
+	Request DownloadRequest
+	Path    string
+}
+
+// Downloader скачивает вложения с докачкой, повторами и ограниченным числом потоков
+type Downloader struct {
+	client     *ChatClient
+	httpClient *http.Client
+	workers    int
+	retries    int
+	retryDelay time.Duration
+	maxHeight  int
+	progress   ProgressFunc
+}
+
+// DownloadOption определяет опции Downloader
+type DownloadOption func(*Downloader)
+
+// WithWorkers задает число одновременных загрузок в DownloadAll
+func WithWorkers(workers int) DownloadOption {
+	return func(d *Downloader) {
+		d.workers = workers
+	}
+}
+
+// WithRetries задает число повторных попыток при обрыве загрузки
+func WithRetries(retries int, delay time.Duration) DownloadOption {
+	return func(d *Downloader) {
+		d.retries = retries
+		d.retryDelay = delay
+	}
+}
+
+// WithMaxVideoHeight ограничивает качество скачиваемого видео (см. BestVideoURL)
+func WithMaxVideoHeight(height int) DownloadOption {
+	return func(d *Downloader) {
+		d.maxHeight = height
+	}
+}
+
+// WithDownloadProgress задает функцию, получающую прогресс скачивания.
+// Поле Progress.Name содержит тип вложения или путь к файлу
+func WithDownloadProgress(fn ProgressFunc) DownloadOption {
+	return func(d *Downloader) {
+		d.progress = fn
+	}
+}
+
+// NewDownloader создает Downloader, использующий соединение клиента для получения ссылок
+func (c *ChatClient) NewDownloader(options ...DownloadOption) *Downloader {
+	d := &Downloader{
+		client:     c,
+		httpClient: c.httpClient,
+		workers:    4,
+		retries:    3,
+		retryDelay: time.Second,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.workers < 1 {
+		d.workers = 1
+	}
+	return d
+}
+
+// ResolveURL получает ссылку для скачивания вложения и ожидаемый размер (-1, если неизвестен)
+func (d *Downloader) ResolveURL(req DownloadRequest) (string, int64, error) {
+	switch a := req.Attach.(type) {
+	case Photo:
+		if a.BaseURL == "" {
+			return "", -1, ErrNotDownloadable
+		}
+		// baseUrl может указывать на уменьшенную копию; скачиваем оригинал
+		return a.PhotoURL(PhotoOriginal), -1, nil
+	case Sticker:
+		if a.URL == "" {
+			return "", -1, ErrNotDownloadable
+		}
+		return a.URL, -1, nil
+	case Audio:
+		if a.URL == "" {
+			return "", -1, ErrNotDownloadable
+		}
+		return a.URL, -1, nil
+	case Video:
+		urls, err := d.client.FetchVideoURLs(a.VideoID, req.ChatID, req.MessageID)
+		if err != nil {
+			return "", -1, err
+		}
+		url := urls.BestVideoURL(d.maxHeight)
+		if url == "" {
+			return "", -1, ErrNotDownloadable
+		}
+		return url, -1, nil
+	case File:
+		reply, err := d.client.request(88, map[string]interface{}{
+			"fileId":    a.FileID,
+			"chatId":    req.ChatID,
+			"messageId": req.MessageID,
+		}, "Get file URL")
+		if err != nil {
+			return "", -1, err
+		}
+		url, _ := reply["url"].(string)
+		if url == "" {
+			return "", -1, ErrNotDownloadable
+		}
+		size := a.Size
+		if size <= 0 {
+			size = -1
+		}
+		return url, size, nil
+	default:
+		return "", -1, ErrNotDownloadable
+	}
+}
+
+// Download скачивает вложение в w. При обрыве соединения загрузка
+// продолжается с места остановки через заголовок Range
+func (d *Downloader) Download(req DownloadRequest, w io.Writer) (int64, error) {
+	return d.DownloadContext(context.Background(), req, w)
+}
+
+// DownloadContext — Download, который прерывается при отмене ctx
+func (d *Downloader) DownloadContext(ctx context.Context, req DownloadRequest, w io.Writer) (int64, error) {
+	url, size, err := d.ResolveURL(req)
+	if err != nil {
+		return 0, err
+	}
+	return d.fetch(ctx, req, url, req.Attach.AttachType(), size, 0, w)
+}
+
+// DownloadFile скачивает вложение в файл. Недокачанные данные хранятся в path+".part",
+// поэтому повторный вызов после сбоя продолжает загрузку
+func (d *Downloader) DownloadFile(req DownloadRequest, path string) error {
+	return d.DownloadFileContext(context.Background(), req, path)
+}
+
+// DownloadFileContext — DownloadFile, который прерывается при отмене ctx.
+// Скачанная часть остается в path+".part"
+func (d *Downloader) DownloadFileContext(ctx context.Context, req DownloadRequest, path string) error {
+	url, size, err := d.ResolveURL(req)
+	if err != nil {
+		return err
+	}
+
+	partPath := path + ".part"
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	_, err = d.fetch(ctx, req, url, path, size, offset, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// DownloadAll скачивает задачи не более чем в workers потоков.
+// Ошибки возвращаются в том же порядке, что и задачи
+func (d *Downloader) DownloadAll(jobs []DownloadJob) []error {
+	errs := make([]error, len(jobs))
+	sem := make(chan struct{}, d.workers)
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, job DownloadJob) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = d.DownloadFile(job.Request, job.Path)
+		}(i, job)
+	}
+	wg.Wait()
+	return errs
+}
+
+// StatusError — ответ HTTP сервера с кодом, отличным от 2xx, при скачивании
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("download failed with status %d", e.StatusCode)
+}
+
+// permanent сообщает, что повтор запроса с тем же адресом не поможет
+func (e *StatusError) permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 &&
+		e.StatusCode != http.StatusRequestTimeout && e.StatusCode != http.StatusTooManyRequests
+}
+
+// expired сообщает, что подписанная ссылка могла истечь и ее стоит запросить заново
+func (e *StatusError) expired() bool {
+	return e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusGone
+}
+
+// fetch скачивает url в w начиная с offset, повторяя запрос при временных ошибках.
+// Если ссылка истекла (403, 410), она один раз запрашивается заново через ResolveURL
+func (d *Downloader) fetch(ctx context.Context, req DownloadRequest, url, name string, size, offset int64, w io.Writer) (int64, error) {
+	written := offset
+	var lastErr error
+	resolved, retryNow := false, false
+
+	var tracker *progressTracker
+	if d.progress != nil {
+		tracker = newProgressTracker(d.progress, name, size, offset)
+		w = &progressWriter{w: w, tracker: tracker}
+	}
+
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 && !retryNow {
+			d.client.logger.Warn("download retry", "attempt", attempt, "err", lastErr)
+			timer := time.NewTimer(time.Duration(attempt) * d.retryDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return written - offset, ctx.Err()
+			}
+		}
+		retryNow = false
+
+		n, total, err := d.fetchOnce(ctx, url, written, w)
+		written += n
+		if size < 0 && total > 0 {
+			size = total
+			if tracker != nil {
+				tracker.total = total
+			}
+		}
+		if ctx.Err() != nil {
+			return written - offset, ctx.Err()
+		}
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.permanent() {
+			if !statusErr.expired() || resolved {
+				return written - offset, err
+			}
+			resolved = true
+			if url, _, err = d.ResolveURL(req); err != nil {
+				return written - offset, err
+			}
+			// Новая ссылка запрашивается сразу и не расходует попытку
+			d.client.logger.Debug("download url expired, resolved again", "status", statusErr.StatusCode)
+			attempt--
+			retryNow = true
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if size >= 0 && written != size {
+			return written - offset, fmt.Errorf("%w: got %d bytes, want %d", ErrSizeMismatch, written, size)
+		}
+		if tracker != nil {
+			tracker.report(true)
+		}
+		return written - offset, nil
+	}
+	return written - offset, lastErr
+}
+
+// fetchOnce выполняет один HTTP запрос и возвращает число записанных байт
+// и полный размер файла, если сервер его сообщил
+func (d *Downloader) fetchOnce(ctx context.Context, url string, offset int64, w io.Writer) (int64, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, -1, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, -1, err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		total = resp.ContentLength
+		// Сервер не поддерживает Range: пропускаем уже записанную часть
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				return 0, total, err
+			}
+		}
+	case http.StatusPartialContent:
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Файл уже скачан полностью
+		return 0, contentRangeTotal(resp.Header.Get("Content-Range")), nil
+	default:
+		return 0, -1, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	atomic.AddUint64(&d.client.downloaded, uint64(n))
+	return n, total, err
+}
+
+// contentRangeTotal извлекает полный размер из заголовка "bytes 100-199/1000"
+func contentRangeTotal(header string) int64 {
+	i := strings.LastIndex(header, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
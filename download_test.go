@@ -0,0 +1,237 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolvePhotoURL(t *testing.T) {
+	d := NewChatClient("token", "device").NewDownloader()
+
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"https://i.oneme.ru/i?r=abc&fn=sqr_288", "https://i.oneme.ru/i?r=abc"},
+		{"https://i.oneme.ru/i?fn=w_1280&r=abc", "https://i.oneme.ru/i?r=abc"},
+		{"https://i.oneme.ru/i?r=abc", "https://i.oneme.ru/i?r=abc"},
+	}
+	for _, tt := range tests {
+		url, size, err := d.ResolveURL(DownloadRequest{Attach: Photo{PhotoID: 1, BaseURL: tt.baseURL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != tt.want || size != -1 {
+			t.Errorf("ResolveURL(%s) = %s, %d, want %s", tt.baseURL, url, size, tt.want)
+		}
+	}
+
+	if _, _, err := d.ResolveURL(DownloadRequest{Attach: Photo{PhotoID: 1}}); !errors.Is(err, ErrNotDownloadable) {
+		t.Errorf("photo without baseUrl: %v", err)
+	}
+}
+
+// statusServer отвечает кодами из statuses по очереди, затем отдает body
+type statusServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	hits     int
+}
+
+func newStatusServer(t *testing.T, body string, statuses ...int) *statusServer {
+	t.Helper()
+	s := &statusServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits++
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *statusServer) hitCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits
+}
+
+func TestDownloadStatusRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		hits     int
+		status   int // 0 — загрузка успешна
+	}{
+		{"not found is permanent", []int{404}, 1, 404},
+		{"bad request is permanent", []int{400}, 1, 400},
+		{"server errors are retried", []int{503, 500}, 3, 0},
+		{"rate limit is retried", []int{429}, 2, 0},
+		{"request timeout is retried", []int{408}, 2, 0},
+		{"retries run out", []int{502, 502, 502, 502}, 4, 502},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStatusServer(t, "photo", tt.statuses...)
+			d := NewChatClient("token", "device").NewDownloader(WithRetries(3, 10*time.Millisecond))
+
+			var buf bytes.Buffer
+			_, err := d.Download(DownloadRequest{Attach: Photo{PhotoID: 1, BaseURL: server.URL + "/p"}}, &buf)
+			if tt.status == 0 {
+				if err != nil || buf.String() != "photo" {
+					t.Fatalf("Download = %q, %v", buf.String(), err)
+				}
+			} else {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+					t.Fatalf("err = %v, want status %d", err, tt.status)
+				}
+			}
+			if server.hitCount() != tt.hits {
+				t.Fatalf("hits = %d, want %d", server.hitCount(), tt.hits)
+			}
+		})
+	}
+}
+
+func TestDownloadResolvesExpiredURL(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusGone} {
+		content := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Первая ссылка уже истекла
+			if r.URL.Query().Get("sig") == "1" {
+				http.Error(w, "expired", status)
+				return
+			}
+			io.WriteString(w, "file body")
+		}))
+		defer content.Close()
+
+		var resolved int32
+		server := newTestServer(t)
+		server.reply = func(frame map[string]interface{}) map[string]interface{} {
+			frame["cmd"] = 1
+			frame["payload"] = map[string]interface{}{}
+			if frame["opcode"].(float64) == 88 {
+				sig := atomic.AddInt32(&resolved, 1)
+				frame["payload"] = map[string]interface{}{"url": fmt.Sprintf("%s/f?sig=%d", content.URL, sig)}
+			}
+			return frame
+		}
+		c := server.client()
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		waitReady(t, c)
+
+		var buf bytes.Buffer
+		d := c.NewDownloader(WithRetries(0, time.Second))
+		if _, err := d.Download(DownloadRequest{Attach: File{FileID: 7}, ChatID: 1, MessageID: 2}, &buf); err != nil {
+			t.Fatalf("status %d: %v", status, err)
+		}
+		if buf.String() != "file body" || atomic.LoadInt32(&resolved) != 2 {
+			t.Fatalf("status %d: body %q, resolved %d times", status, buf.String(), resolved)
+		}
+		c.Stop()
+	}
+}
+
+// hangingServer отдает начало файла и не завершает ответ до release
+func hangingServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return server, started
+}
+
+func TestDownloadContextCancel(t *testing.T) {
+	server, started := hangingServer(t)
+	d := NewChatClient("token", "device").NewDownloader(WithRetries(3, time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	start := time.Now()
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	err := d.DownloadFileContext(ctx, DownloadRequest{Attach: Photo{PhotoID: 1, BaseURL: server.URL}}, path)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("cancel took %s", time.Since(start))
+	}
+	// Недокачанная часть остается для продолжения загрузки
+	if _, err := os.Stat(path + ".part"); err != nil {
+		t.Fatalf("part file: %v", err)
+	}
+}
+
+func TestCloseCancelsArchiveDownload(t *testing.T) {
+	content, started := hangingServer(t)
+	server := newTestServer(t)
+	c := server.client(WithMediaArchive(t.TempDir(), ""))
+	c.WatchChats = []string{"1"}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+
+	server.push(map[string]interface{}{"ver": 11, "cmd": 0, "seq": 0, "opcode": 128, "payload": map[string]interface{}{
+		"chatId": 1,
+		"message": map[string]interface{}{"id": 5, "sender": 2, "attaches": []interface{}{
+			map[string]interface{}{"_type": "PHOTO", "photoId": 3, "baseUrl": content.URL},
+		}},
+	}})
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("archive download did not start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close with a download in progress: %v", err)
+	}
+	for range c.Messages() {
+	}
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"time"
 
@@ -33,20 +35,42 @@ func main() {
 		deviceID,
 		maxclientapi.WithDebug(false),           // Enable/disable debug mode
 		maxclientapi.WithAllowReconnect(true),   // Auto-reconnect on disconnect
+		// maxclientapi.WithLogger(slog.Default()), // Structured logs (silent by default)
 	)
 
+	// Log connection state changes (connecting, handshaking, ready, reconnecting, closed)
+	client.OnStateChange(func(from, to maxclientapi.State) {
+		log.Printf("connection state: %s -> %s", from, to)
+	})
+
 	// Connect to the server
 	err := client.Connect()
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
 
+	// Wait until the server accepts the handshake before sending anything
+	select {
+	case <-client.Ready():
+	case <-time.After(30 * time.Second):
+		log.Fatal("Handshake timed out")
+	}
+
 	// Start keepalive (sends periodic pings to keep the connection active)
 	client.StartKeepalive(25 * time.Second)
 
 	// Send a text message to the chat
 	client.SendMessage(chatID, "Hello")
 
+	// Relay a file straight from the web without saving it to disk:
+	// the content type is sniffed and the photo/video/voice/file path is chosen automatically
+	kind, err := client.UploadFromURL(chatID, "https://example.com/picture.png", "Relayed picture")
+	if err != nil {
+		log.Printf("Failed to relay file: %v", err)
+	} else {
+		fmt.Println("relayed as:", kind)
+	}
+
 	// Subscribe to chat updates (so the client receives incoming messages)
 	client.SubscribeChat(chatID)
 
@@ -57,12 +81,21 @@ func main() {
 	var tokenFile string
 	var fileID interface{}
 
-	// Main loop — continuously listens for new incoming messages
-	for {
-		msg := client.GetMessageBlocking() // Wait for a new message (blocking call)
-		if msg == nil {
-			continue // Skip iteration if no message received
+	// Shut down gracefully on Ctrl+C: queued frames are flushed, the socket is closed
+	// properly and the message channel is closed, which ends the loop below
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Close(ctx); err != nil {
+			log.Printf("Close: %v", err)
 		}
+	}()
+
+	// Main loop — listens for new incoming messages until the client is closed
+	for msg := range client.Messages() {
 
 		msgType, ok := msg["type"].(string)
 		if !ok {
@@ -74,93 +107,51 @@ func main() {
 		case "download_link":
 			fmt.Printf("External: %v\n", msg["EXTERNAL"])
 			fmt.Printf("video_url: %v\n", msg["video_url"])
+			fmt.Printf("videoId: %v\n", msg["videoId"])
+
+			// Pick a specific quality instead of the best available one
+			if urls, ok := msg["renditions"].(*maxclientapi.VideoURLs); ok {
+				fmt.Printf("720p or lower: %s\n", urls.BestVideoURL(720))
+			}
 			fmt.Printf("raw: %v\n", msg["raw"])
 
-		// If the message contains a photo
-		case "photo":
+		// A new message: text plus the ordered list of all its attachments
+		case "message":
 			fmt.Println("chat_id:", msg["chat_id"])
 			fmt.Println("sender:", msg["sender"])
 			fmt.Println("id:", msg["id"])
 			fmt.Println("time:", msg["time"])
-			fmt.Println("utype:", msg["utype"])
-			fmt.Println("baseUrl:", msg["baseUrl"])
-			fmt.Println("previewData:", msg["previewData"])
-			fmt.Println("photoToken:", msg["photoToken"])
-			fmt.Println("width:", msg["width"])
-			fmt.Println("photoId:", msg["photoId"])
-			fmt.Println("height:", msg["height"])
-			fmt.Println("raw:", msg["raw"])
-
-		// If the message contains a photo with text
-		case "photo_with_text":
 			fmt.Println("text:", msg["text"])
-			fmt.Println("chat_id:", msg["chat_id"])
-			fmt.Println("sender:", msg["sender"])
-			fmt.Println("id:", msg["id"])
-			fmt.Println("time:", msg["time"])
-			fmt.Println("utype:", msg["utype"])
-			fmt.Println("baseUrl:", msg["baseUrl"])
-			fmt.Println("previewData:", msg["previewData"])
-			fmt.Println("photoToken:", msg["photoToken"])
-			fmt.Println("width:", msg["width"])
-			fmt.Println("photoId:", msg["photoId"])
-			fmt.Println("height:", msg["height"])
-			fmt.Println("raw:", msg["raw"])
-
-		// If the message contains a video
-		case "video":
-			fmt.Printf("chat_id: %v\n", msg["chat_id"])
-			fmt.Printf("sender: %v\n", msg["sender"])
-			fmt.Printf("thumbnail: %v\n", msg["thumbnail"])
-			fmt.Printf("duration: %v\n", msg["duration"])
-			fmt.Printf("width: %v\n", msg["width"])
-			fmt.Printf("videoId: %v\n", msg["videoId"])
-			fmt.Printf("token: %v\n", msg["token"])
-			fmt.Printf("height: %v\n", msg["height"])
-			fmt.Printf("raw: %v\n", msg["raw"])
-			fmt.Printf("id: %v\n", msg["id"])
-			fmt.Printf("time: %v\n", msg["time"])
-			fmt.Printf("utype: %v\n", msg["utype"])
-			fmt.Printf("prevMessageId: %v\n", msg["prevMessageId"])
-
-			// Save the video token
-			tokenFile = fmt.Sprintf("%v", msg["token"])
-
-			// Request the video URL for downloading
-			client.GetVideoURL(msg["videoId"], chatID, msg["id"])
-
-		// If the message contains a video with text
-		case "video_with_text":
-			fmt.Printf("text: %v\n", msg["text"])
-			fmt.Printf("chat_id: %v\n", msg["chat_id"])
-			fmt.Printf("sender: %v\n", msg["sender"])
-			fmt.Printf("thumbnail: %v\n", msg["thumbnail"])
-			fmt.Printf("duration: %v\n", msg["duration"])
-			fmt.Printf("width: %v\n", msg["width"])
-			fmt.Printf("videoId: %v\n", msg["videoId"])
-			fmt.Printf("token: %v\n", msg["token"])
-			fmt.Printf("height: %v\n", msg["height"])
-			fmt.Printf("raw: %v\n", msg["raw"])
-			fmt.Printf("id: %v\n", msg["id"])
-			fmt.Printf("time: %v\n", msg["time"])
-			fmt.Printf("utype: %v\n", msg["utype"])
-			fmt.Printf("prevMessageId: %v\n", msg["prevMessageId"])
-
-			// Save the video token
-			tokenFile = fmt.Sprintf("%v", msg["token"])
-
-			// Request the video URL for downloading
-			client.GetVideoURL(msg["videoId"], chatID, msg["id"])
 
-		// If the message is a regular text message
-		case "text":
-			fmt.Println("text:", msg["text"])
-			fmt.Println("chat_id:", msg["chat_id"])
-			fmt.Println("sender:", msg["sender"])
-			fmt.Println("id:", msg["id"])
-			fmt.Println("time:", msg["time"])
-			fmt.Println("utype:", msg["utype"])
-			fmt.Println("prevMessageId:", msg["prevMessageId"])
+			attaches, _ := msg["attaches"].([]maxclientapi.Attachment)
+			for _, attach := range attaches {
+				switch a := attach.(type) {
+				case maxclientapi.Photo:
+					fmt.Printf("photo: %s (%dx%d)\n", a.BaseURL, a.Width, a.Height)
+				case maxclientapi.Video:
+					fmt.Printf("video: %d, duration %d ms\n", a.VideoID, a.Duration)
+
+					// Save the video token
+					tokenFile = a.Token
+
+					// Request the video URL for downloading
+					client.GetVideoURL(a.VideoID, chatID, msg["id"])
+				case maxclientapi.File:
+					fmt.Printf("file: %s (%d bytes)\n", a.Name, a.Size)
+				case maxclientapi.Audio:
+					fmt.Printf("voice: %d ms\n", a.Duration)
+				case maxclientapi.Share:
+					fmt.Printf("link: %s\n", a.URL)
+				case maxclientapi.InlineKeyboard:
+					for _, row := range a.Rows() {
+						for _, button := range row {
+							fmt.Printf("button: %s (%s)\n", button.Text, button.Type)
+						}
+					}
+				default:
+					fmt.Printf("attach: %s %+v\n", a.AttachType(), a)
+				}
+			}
 
 		// If the server provides a URL for file upload
 		case "url_upload":
@@ -182,12 +173,6 @@ func main() {
 			// After the file is uploaded, send it to the chat
 			client.SendFile(chatID, fileID)
 
-		// If the message is a link
-		case "link":
-			fmt.Printf("text: %v\n", msg["text"])
-			fmt.Printf("chat_id: %v\n", msg["chat_id"])
-			fmt.Printf("sender: %v\n", msg["sender"])
-
 		default:
 			fmt.Printf("Unknown message type: %s\n", msgType)
 		}
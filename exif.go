@@ -0,0 +1,222 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// ErrMalformedImage возвращается, если структуру JPEG или PNG не удалось разобрать
+var ErrMalformedImage = errors.New("maxclientapi: malformed image")
+
+var (
+	jpegSOI      = []byte{0xFF, 0xD8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	mpfHeader    = []byte("MPF\x00")
+)
+
+// Тег EXIF с ориентацией изображения
+const exifOrientationTag = 0x0112
+
+// stripMetadata удаляет EXIF, XMP, IPTC и текстовые комментарии из JPEG и PNG
+// без перекодирования. При keepOrientation тег ориентации сохраняется, чтобы
+// снимки с телефона не отображались повернутыми. Остальные форматы не изменяются
+func stripMetadata(data []byte, keepOrientation bool) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data, keepOrientation)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data, keepOrientation)
+	default:
+		return data, nil
+	}
+}
+
+// stripJPEG оставляет только сегменты, нужные для декодирования и цветопередачи.
+// Данные после EOI (например, дополнительные изображения MPF со своим EXIF) отбрасываются
+func stripJPEG(data []byte, keepOrientation bool) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(jpegSOI)
+
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, ErrMalformedImage
+		}
+		marker := data[pos+1]
+		// Байты-заполнители 0xFF перед маркером
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		// Маркеры без длины
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+		if marker == 0xD9 {
+			out.Write(data[pos : pos+2])
+			return out.Bytes(), nil
+		}
+		if pos+4 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrMalformedImage
+		}
+		segment := data[pos+4 : end]
+
+		switch {
+		case marker == 0xDA:
+			// Сжатые данные идут до следующего маркера; в прогрессивном JPEG сканов несколько
+			next := scanEnd(data, end)
+			if next < 0 {
+				return nil, ErrMalformedImage
+			}
+			out.Write(data[pos:next])
+			end = next
+		case marker == 0xE1:
+			// APP1: EXIF или XMP
+			if keepOrientation && bytes.HasPrefix(segment, exifHeader) {
+				if orientation := tiffOrientation(segment[len(exifHeader):]); orientation > 1 {
+					writeJPEGSegment(out, 0xE1, append(append([]byte{}, exifHeader...), orientationTIFF(orientation)...))
+				}
+			}
+		case marker == 0xE2 && bytes.HasPrefix(segment, mpfHeader):
+			// APP2 MPF ссылается на изображения после EOI, которые удаляются
+		case marker == 0xED, marker == 0xFE:
+			// APP13 (IPTC) и комментарии
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+}
+
+// scanEnd возвращает позицию маркера, завершающего сжатые данные скана, или -1.
+// 0xFF00 (экранированный байт) и маркеры RST относятся к самим данным
+func scanEnd(data []byte, pos int) int {
+	for i := pos; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		next := data[i+1]
+		if next == 0x00 || next == 0xFF || (next >= 0xD0 && next <= 0xD7) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+func writeJPEGSegment(out *bytes.Buffer, marker byte, payload []byte) {
+	var header [4]byte
+	header[0] = 0xFF
+	header[1] = marker
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	out.Write(header[:])
+	out.Write(payload)
+}
+
+// stripPNG удаляет текстовые чанки и eXIf
+func stripPNG(data []byte, keepOrientation bool) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrMalformedImage
+		}
+		// Длина проверяется в uint64: на 32-битных платформах pos+12+length переполняет int
+		length := binary.BigEndian.Uint32(data[pos : pos+4])
+		if uint64(pos)+12+uint64(length) > uint64(len(data)) {
+			return nil, ErrMalformedImage
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + int(length)
+
+		switch chunkType {
+		case "tEXt", "zTXt", "iTXt", "tIME":
+		case "eXIf":
+			if keepOrientation {
+				if orientation := tiffOrientation(data[pos+8 : end-4]); orientation > 1 {
+					writePNGChunk(out, "eXIf", orientationTIFF(orientation))
+				}
+			}
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, payload []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	out.Write(length[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	out.WriteString(chunkType)
+	out.Write(payload)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	out.Write(sum[:])
+}
+
+// tiffOrientation читает тег ориентации из IFD0 TIFF структуры EXIF; 0, если его нет
+func tiffOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := order.Uint32(tiff[4:8])
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	ifd := int(offset)
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == exifOrientationTag {
+			return order.Uint16(tiff[entry+8 : entry+10])
+		}
+	}
+	return 0
+}
+
+// orientationTIFF строит минимальную TIFF структуру с единственным тегом ориентации
+func orientationTIFF(orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	copy(tiff, "MM")
+	binary.BigEndian.PutUint16(tiff[2:], 42)
+	binary.BigEndian.PutUint32(tiff[4:], 8)
+	binary.BigEndian.PutUint16(tiff[8:], 1)
+	binary.BigEndian.PutUint16(tiff[10:], exifOrientationTag)
+	binary.BigEndian.PutUint16(tiff[12:], 3) // SHORT
+	binary.BigEndian.PutUint32(tiff[14:], 1)
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	// tiff[22:26] — смещение следующего IFD, 0
+	return tiff
+}
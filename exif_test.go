@@ -0,0 +1,242 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage — небольшое изображение с градиентом, чтобы сжатые данные были непустыми
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 16), 128, 255})
+		}
+	}
+	return img
+}
+
+// exifTIFF строит EXIF с ориентацией, моделью камеры и GPS IFD
+func exifTIFF(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	order := binary.BigEndian
+	tiff.WriteString("MM")
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+
+	// IFD0: Orientation, Model, GPSInfo
+	const ifd0Size = 2 + 3*12 + 4
+	modelOffset := uint32(8 + ifd0Size)
+	model := []byte("SecretCam\x00")
+	gpsOffset := modelOffset + uint32(len(model))
+
+	binary.Write(&tiff, order, uint16(3))
+	binary.Write(&tiff, order, []uint16{exifOrientationTag, 3})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, []uint16{orientation, 0})
+	binary.Write(&tiff, order, []uint16{0x0110, 2})
+	binary.Write(&tiff, order, []uint32{uint32(len(model)), modelOffset})
+	binary.Write(&tiff, order, []uint16{0x8825, 4})
+	binary.Write(&tiff, order, []uint32{1, gpsOffset})
+	binary.Write(&tiff, order, uint32(0))
+	tiff.Write(model)
+
+	// GPS IFD: GPSLatitudeRef и GPSMapDatum
+	datum := []byte("SECRETGPS\x00")
+	datumOffset := gpsOffset + 2 + 2*12 + 4
+	binary.Write(&tiff, order, uint16(2))
+	binary.Write(&tiff, order, []uint16{0x0001, 2})
+	binary.Write(&tiff, order, uint32(2))
+	tiff.Write([]byte{'N', 0, 0, 0})
+	binary.Write(&tiff, order, []uint16{0x0012, 2})
+	binary.Write(&tiff, order, []uint32{uint32(len(datum)), datumOffset})
+	binary.Write(&tiff, order, uint32(0))
+	tiff.Write(datum)
+	return tiff.Bytes()
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	var out bytes.Buffer
+	writeJPEGSegment(&out, marker, payload)
+	return out.Bytes()
+}
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	var out bytes.Buffer
+	writePNGChunk(&out, chunkType, payload)
+	return out.Bytes()
+}
+
+// testJPEG кодирует testImage и вставляет после SOI сегменты метаданных, а после EOI — хвост
+func testJPEG(t *testing.T, orientation uint16, trailer []byte) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	out.Write(jpegSOI)
+	out.Write(jpegSegment(0xE1, append(append([]byte{}, exifHeader...), exifTIFF(orientation)...)))
+	out.Write(jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>SecretXMP</x:xmpmeta>")))
+	out.Write(jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile")))
+	out.Write(jpegSegment(0xE2, append(append([]byte{}, mpfHeader...), "MM\x00\x2a"...)))
+	out.Write(jpegSegment(0xED, []byte("Photoshop 3.0\x00SecretIPTC")))
+	out.Write(jpegSegment(0xFE, []byte("SecretComment")))
+	out.Write(encoded.Bytes()[2:])
+	out.Write(trailer)
+	return out.Bytes()
+}
+
+var jpegSecrets = []string{"SecretCam", "SECRETGPS", "SecretXMP", "SecretIPTC", "SecretComment", "MPF\x00"}
+
+func TestStripJPEG(t *testing.T) {
+	// Второе изображение MPF после EOI со своим EXIF и GPS
+	trailer := append([]byte{0xFF, 0xD8}, jpegSegment(0xE1, append(append([]byte{}, exifHeader...), exifTIFF(1)...))...)
+
+	for _, keep := range []bool{false, true} {
+		data := testJPEG(t, 6, trailer)
+		stripped, err := stripMetadata(data, keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range jpegSecrets {
+			if bytes.Contains(stripped, []byte(secret)) {
+				t.Errorf("keep=%v: %q is not removed", keep, secret)
+			}
+		}
+		if !bytes.HasSuffix(stripped, []byte{0xFF, 0xD9}) {
+			t.Errorf("keep=%v: data after EOI is not removed", keep)
+		}
+		if !bytes.Contains(stripped, []byte("ICC_PROFILE")) {
+			t.Errorf("keep=%v: ICC profile removed", keep)
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(stripped))
+		if err != nil {
+			t.Fatalf("keep=%v: decode: %v", keep, err)
+		}
+		if img.Bounds() != testImage().Bounds() {
+			t.Fatalf("keep=%v: bounds %v", keep, img.Bounds())
+		}
+
+		i := bytes.Index(stripped, exifHeader)
+		switch {
+		case !keep && i >= 0:
+			t.Error("EXIF is kept without keepOrientation")
+		case keep && i < 0:
+			t.Error("orientation is dropped")
+		case keep && tiffOrientation(stripped[i+len(exifHeader):]) != 6:
+			t.Errorf("orientation = %d, want 6", tiffOrientation(stripped[i+len(exifHeader):]))
+		}
+	}
+
+	// Ориентация 1 не требует EXIF
+	stripped, err := stripMetadata(testJPEG(t, 1, nil), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, exifHeader) {
+		t.Error("EXIF is kept for the default orientation")
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	// IHDR всегда первый: подпись 8 байт и чанк 25 байт
+	head := encoded.Bytes()[:8+25]
+	var data []byte
+	data = append(data, head...)
+	data = append(data, pngChunk("eXIf", exifTIFF(3))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00SecretComment"))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00SecretXMP"))...)
+	data = append(data, encoded.Bytes()[8+25:]...)
+
+	for _, keep := range []bool{false, true} {
+		stripped, err := stripMetadata(data, keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"SecretCam", "SECRETGPS", "SecretComment", "SecretXMP"} {
+			if bytes.Contains(stripped, []byte(secret)) {
+				t.Errorf("keep=%v: %q is not removed", keep, secret)
+			}
+		}
+		if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+			t.Fatalf("keep=%v: decode: %v", keep, err)
+		}
+
+		i := bytes.Index(stripped, []byte("eXIf"))
+		switch {
+		case !keep && i >= 0:
+			t.Error("eXIf is kept without keepOrientation")
+		case keep && i < 0:
+			t.Error("orientation is dropped")
+		case keep:
+			length := binary.BigEndian.Uint32(stripped[i-4 : i])
+			chunk := stripped[i+4 : i+4+int(length)]
+			if tiffOrientation(chunk) != 3 {
+				t.Errorf("orientation = %d, want 3", tiffOrientation(chunk))
+			}
+			if crc32.ChecksumIEEE(stripped[i:i+4+int(length)]) != binary.BigEndian.Uint32(stripped[i+4+int(length):]) {
+				t.Error("eXIf CRC is wrong")
+			}
+		}
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	valid := testJPEG(t, 6, nil)
+	sos := bytes.Index(valid, []byte{0xFF, 0xDA})
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"jpeg only SOI", []byte{0xFF, 0xD8}},
+		{"jpeg no marker", []byte{0xFF, 0xD8, 0x00, 0x10}},
+		{"jpeg short length", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}},
+		{"jpeg segment past end", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E', 'x'}},
+		{"jpeg truncated scan", valid[:sos+40]},
+		{"png truncated chunk", encoded.Bytes()[:20]},
+		{"png length past end", append(append([]byte{}, pngSignature...), 0x7F, 0xFF, 0xFF, 0xFF, 'I', 'H', 'D', 'R')},
+		{"png max length", append(append([]byte{}, pngSignature...), 0xFF, 0xFF, 0xFF, 0xFF, 'I', 'H', 'D', 'R')},
+	}
+	for _, tt := range tests {
+		if _, err := stripMetadata(tt.data, true); !errors.Is(err, ErrMalformedImage) {
+			t.Errorf("%s: err = %v, want ErrMalformedImage", tt.name, err)
+		}
+	}
+
+	// Смещение IFD у конца диапазона uint32 не должно переполнять int
+	var chunk bytes.Buffer
+	chunk.Write(pngSignature)
+	writePNGChunk(&chunk, "eXIf", []byte("MM\x00\x2A\xFF\xFF\xFF\xF0"))
+	if out, err := stripMetadata(chunk.Bytes(), true); err != nil || !bytes.Equal(out, pngSignature) {
+		t.Errorf("huge ifd offset: %v, %v", out, err)
+	}
+	if orientation := tiffOrientation([]byte("II\x2A\x00\xFE\xFF\xFF\xFF")); orientation != 0 {
+		t.Errorf("huge ifd offset: orientation = %d", orientation)
+	}
+
+	// Остальные форматы не изменяются
+	gif := []byte("GIF89a\x01\x00\x01\x00")
+	if out, err := stripMetadata(gif, false); err != nil || !bytes.Equal(out, gif) {
+		t.Errorf("gif: %v, %v", out, err)
+	}
+}
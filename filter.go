@@ -0,0 +1,43 @@
+package maxclientapi
+
+import "strconv"
+
+// acceptMessage применяет фильтры чатов и отправителей к входящему сообщению.
+// Непустой WatchChats работает как список разрешенных чатов
+func (c *ChatClient) acceptMessage(chatID, sender interface{}) bool {
+	if len(c.WatchChats) > 0 && !c.isWatched(chatID) {
+		return false
+	}
+	if containsID(c.blockChats, chatID) || containsID(c.blockSenders, sender) {
+		return false
+	}
+	if c.senderFilter != nil && !c.senderFilter(chatID, sender) {
+		return false
+	}
+	return true
+}
+
+// subscribeWatchChats подписывается на все чаты из WatchChats
+func (c *ChatClient) subscribeWatchChats() {
+	for _, chat := range c.WatchChats {
+		var chatID interface{} = chat
+		if id, err := strconv.ParseInt(chat, 10, 64); err == nil {
+			chatID = id
+		}
+		c.SubscribeChat(chatID)
+	}
+}
+
+// containsID проверяет, есть ли идентификатор в списке строк
+func containsID(list []string, id interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	s := idString(id)
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package maxclientapi
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrDeadConnection — сервер перестал отвечать на keepalive или WebSocket ping
+var ErrDeadConnection = errors.New("maxclientapi: connection is dead")
+
+// WithMissedPongs задает, сколько keepalive пингов подряд может остаться без ответа,
+// прежде чем соединение будет признано мертвым и разорвано (по умолчанию 3)
+func WithMissedPongs(count int) Option {
+	return func(c *ChatClient) {
+		c.missedPongs = count
+	}
+}
+
+// WithReadTimeout включает WebSocket ping каждые timeout/2 и разрывает соединение,
+// если за timeout от сервера не пришло ни одного кадра (по умолчанию выключено)
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *ChatClient) {
+		c.readTimeout = timeout
+	}
+}
+
+// ping отправляет keepalive (opcode 1), ждет ответ не дольше timeout и запоминает RTT
+func (c *ChatClient) ping(timeout time.Duration) error {
+	start := time.Now()
+	_, err := c.requestWithin(1, map[string]interface{}{
+		"interactive": false,
+	}, "", timeout)
+	if err == nil {
+		c.rtt.add(time.Since(start))
+	}
+	return err
+}
+
+// keepalive отправляет пинги каждые interval, пока stop не закрыт, и разрывает
+// соединение после missedPongs пингов без ответа подряд
+func (c *ChatClient) keepalive(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var cn *connection
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		// Во время переподключения и handshake пинги пропускаются
+		if c.State() != StateReady {
+			continue
+		}
+		if current := c.currentConnection(); current != cn {
+			cn, missed = current, 0
+		}
+		if cn == nil {
+			continue
+		}
+
+		err := c.ping(interval)
+		if !errors.Is(err, ErrTimeout) {
+			missed = 0
+			continue
+		}
+		missed++
+		c.logger.Warn("keepalive reply missed", "opcode", 1, "missed", missed, "threshold", c.missedPongs)
+		if missed >= c.missedPongs {
+			c.dropConnection(cn, ErrDeadConnection)
+		}
+	}
+}
+
+// watchConnection включает read deadline и WebSocket ping/pong для соединения cn
+func (c *ChatClient) watchConnection(cn *connection) {
+	if c.readTimeout <= 0 {
+		return
+	}
+	cn.ws.SetReadDeadline(time.Now().Add(c.readTimeout))
+	cn.ws.SetPongHandler(func(string) error {
+		return cn.ws.SetReadDeadline(time.Now().Add(c.readTimeout))
+	})
+}
+
+// extendDeadline продлевает read deadline после полученного кадра
+func (c *ChatClient) extendDeadline(cn *connection) {
+	if c.readTimeout > 0 {
+		cn.ws.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+}
+
+// pingTicker возвращает канал для отправки WebSocket ping или nil, если read timeout выключен
+func (c *ChatClient) pingTicker() (<-chan time.Time, func()) {
+	if c.readTimeout <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(c.readTimeout / 2)
+	return ticker.C, ticker.Stop
+}
+
+// writePing отправляет WebSocket ping; вызывается только из writeHandler
+func (c *ChatClient) writePing(cn *connection) error {
+	return cn.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.readTimeout/2))
+}
@@ -0,0 +1,159 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// silentPings — ответ сервера, который не отвечает на keepalive (opcode 1)
+func silentPings(frame map[string]interface{}) map[string]interface{} {
+	if frame["opcode"].(float64) == 1 {
+		return nil
+	}
+	frame["cmd"] = 1
+	frame["payload"] = map[string]interface{}{}
+	return frame
+}
+
+func waitDone(t *testing.T, c *ChatClient) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("client did not finish, state %s", c.State())
+		return nil
+	}
+}
+
+func TestMissedPongsDropConnection(t *testing.T) {
+	server := newTestServer(t)
+	server.reply = silentPings
+	c := server.client(WithMissedPongs(2))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+
+	start := time.Now()
+	c.StartKeepalive(20 * time.Millisecond)
+	if err := waitDone(t, c); !errors.Is(err, ErrDeadConnection) {
+		t.Fatalf("Wait() = %v, want ErrDeadConnection", err)
+	}
+	// Два пинга без ответа: каждый ждет интервал после тика
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("connection dropped after %s, before two pings were missed", elapsed)
+	}
+	if c.State() != StateClosed {
+		t.Fatalf("state %s, want closed", c.State())
+	}
+}
+
+func TestMissedPongsReconnect(t *testing.T) {
+	server := newTestServer(t)
+	server.reply = silentPings
+	c := server.client(WithMissedPongs(2), WithAllowReconnect(true))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	c.StartKeepalive(20 * time.Millisecond)
+	// Сервер видит новое соединение раньше, чем клиент учтет переподключение
+	deadline := time.Now().Add(5 * time.Second)
+	for server.connections() < 2 || c.Stats().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reconnect after missed pongs: %d connections, %d reconnects",
+				server.connections(), c.Stats().Reconnects)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReadTimeoutDropsHalfOpenConnection(t *testing.T) {
+	server := newTestServer(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		if frame["opcode"].(float64) == 49 {
+			// Сервер перестает читать соединение и не отвечает на WebSocket ping
+			<-release
+			return nil
+		}
+		frame["cmd"] = 1
+		frame["payload"] = map[string]interface{}{}
+		return frame
+	}
+	c := server.client(WithReadTimeout(100 * time.Millisecond))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+
+	// Пока сервер читает, WebSocket ping продлевает соединение дольше read timeout
+	time.Sleep(300 * time.Millisecond)
+	if c.State() != StateReady {
+		t.Fatalf("state %s while the server answers pings", c.State())
+	}
+
+	c.send(49, map[string]interface{}{}, "")
+	if err := waitDone(t, c); !errors.Is(err, ErrDeadConnection) {
+		t.Fatalf("Wait() = %v, want ErrDeadConnection", err)
+	}
+}
+
+// keepaliveRunning проверяет, осталась ли горутина keepalive
+func keepaliveRunning() bool {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	return bytes.Contains(buf, []byte("(*ChatClient).keepalive("))
+}
+
+func TestKeepaliveStopsWhenSessionEnds(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(frame map[string]interface{}) map[string]interface{}
+		drop  bool
+	}{
+		{"handshake rejected", func(frame map[string]interface{}) map[string]interface{} {
+			frame["cmd"] = 1
+			frame["payload"] = map[string]interface{}{}
+			if frame["opcode"].(float64) == 19 {
+				frame["cmd"] = 3
+				frame["payload"] = map[string]interface{}{"error": "login.token"}
+			}
+			return frame
+		}, false},
+		{"disconnect", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			server.reply = tt.reply
+			c := server.client()
+			if err := c.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			c.StartKeepalive(time.Millisecond)
+			if tt.drop {
+				waitReady(t, c)
+				server.dropAll()
+			}
+			waitDone(t, c)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for keepaliveRunning() {
+				if time.Now().After(deadline) {
+					t.Fatal("keepalive goroutine is still running")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package maxclientapi
+
+import "strings"
+
+// ButtonType определяет тип кнопки inline-клавиатуры
+type ButtonType string
+
+const (
+	ButtonCallback        ButtonType = "callback"
+	ButtonLink            ButtonType = "link"
+	ButtonRequestContact  ButtonType = "request_contact"
+	ButtonRequestLocation ButtonType = "request_geo_location"
+)
+
+// Button описывает кнопку inline-клавиатуры
+type Button struct {
+	Type    ButtonType `json:"type"`
+	Text    string     `json:"text"`
+	Payload string     `json:"payload,omitempty"`
+	URL     string     `json:"url,omitempty"`
+	Intent  string     `json:"intent,omitempty"`
+	Quick   bool       `json:"quick,omitempty"`
+}
+
+// InlineKeyboard описывает вложение INLINE_KEYBOARD, которое присылают боты
+type InlineKeyboard struct {
+	CallbackID string `json:"callbackId,omitempty"`
+	Keyboard   struct {
+		Buttons [][]Button `json:"buttons"`
+	} `json:"keyboard"`
+}
+
+func (InlineKeyboard) AttachType() string { return "INLINE_KEYBOARD" }
+
+// Rows возвращает ряды кнопок клавиатуры
+func (k InlineKeyboard) Rows() [][]Button {
+	return k.Keyboard.Buttons
+}
+
+// Find ищет кнопку по тексту
+func (k InlineKeyboard) Find(text string) (Button, bool) {
+	for _, row := range k.Keyboard.Buttons {
+		for _, button := range row {
+			if button.Text == text {
+				return button, true
+			}
+		}
+	}
+	return Button{}, false
+}
+
+// normalize приводит типы кнопок к нижнему регистру: веб-клиент присылает "CALLBACK"
+func (k *InlineKeyboard) normalize() {
+	for _, row := range k.Keyboard.Buttons {
+		for i := range row {
+			row[i].Type = ButtonType(strings.ToLower(string(row[i].Type)))
+		}
+	}
+}
+
+// PressButton нажимает callback-кнопку inline-клавиатуры в сообщении бота
+func (c *ChatClient) PressButton(chatID, messageID interface{}, payload string) error {
+	_, err := c.request(118, map[string]interface{}{
+		"chatId":    chatID,
+		"messageId": messageID,
+		"payload":   payload,
+	}, "Button callback")
+	return err
+}
@@ -0,0 +1,56 @@
+package maxclientapi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger — структурированный логгер с уровнями. *slog.Logger подходит без адаптера.
+// args — пары ключ, значение: opcode, seq, chat_id и т. п.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// WithLogger задает логгер клиента. По умолчанию клиент ничего не пишет,
+// а с WithDebug(true) пишет все уровни в стандартный log
+func WithLogger(logger Logger) Option {
+	return func(c *ChatClient) {
+		c.logger = logger
+	}
+}
+
+// nopLogger отбрасывает все записи
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// stdLogger пишет в стандартный log в виде "[MAXCLIENTAPI] LEVEL msg key=value"
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, args ...any) { stdLog("DEBUG", msg, args) }
+func (stdLogger) Info(msg string, args ...any)  { stdLog("INFO", msg, args) }
+func (stdLogger) Warn(msg string, args ...any)  { stdLog("WARN", msg, args) }
+func (stdLogger) Error(msg string, args ...any) { stdLog("ERROR", msg, args) }
+
+func stdLog(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString("[MAXCLIENTAPI] ")
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	log.Print(b.String())
+}
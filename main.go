@@ -2,9 +2,12 @@ package maxclientapi
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,6 +15,18 @@ import (
 
 // ChatClient представляет клиент для работы с чатом
 type ChatClient struct {
+	// Счетчики идут первыми, чтобы atomic работал на 32-битных платформах
+	dropped    uint64
+	seq        int64
+	framesIn   uint64
+	framesOut  uint64
+	bytesIn    uint64
+	bytesOut   uint64
+	reconnects uint64
+	uploaded   uint64
+	downloaded uint64
+	handshake  int64
+
 	URL            string
 	Token          string
 	WatchChats     []string
@@ -22,14 +37,56 @@ type ChatClient struct {
 	DeviceID       string
 	Origin         string
 	
-	ws             *websocket.Conn
-	seq            int
-	running        bool
+	conn           *connection
 	messages       chan map[string]interface{}
 	allowReconnect bool
 	debug          bool
+	perAttachEvents bool
 	mu             sync.Mutex
 	stopChan       chan struct{}
+	stopOnce       *sync.Once
+	connectMu      sync.Mutex
+	state          State
+	ready          chan struct{}
+	stateHandlers  []func(from, to State)
+	transitions    [][2]State
+	notifying      bool
+	wg             sync.WaitGroup
+	closed         bool
+	closing        chan struct{}
+	done           chan struct{}
+	doneErr        error
+
+	httpClient        *http.Client
+	requestTimeout    time.Duration
+	processingTimeout time.Duration
+	missedPongs       int
+	reconnectDelay    time.Duration
+	closeTimeout      time.Duration
+	readTimeout       time.Duration
+	logger            Logger
+	redaction         bool
+	redactFields      []string
+	connectedAt       time.Time
+	rtt               rttWindow
+	opcodeStats       opcodeStats
+	pendingMu         sync.Mutex
+	pending           map[int]chan map[string]interface{}
+	attachWaiters     map[string]chan map[string]interface{}
+	videoRequests     map[int]videoRequest
+	uploadCache       *UploadCache
+	archiver          *mediaArchiver
+	blockChats        []string
+	blockSenders      []string
+	senderFilter      func(chatID, sender interface{}) bool
+
+	queuePolicy  QueuePolicy
+	queueTimeout time.Duration
+	spillDir     string
+	spill        *spillQueue
+	spillOnce    sync.Once
+	inbox        inbox
+	dispatchOnce sync.Once
 }
 
 // NewChatClient создает новый экземпляр клиента
@@ -46,9 +103,26 @@ func NewChatClient(token, deviceID string, options ...Option) *ChatClient {
 		messages:        make(chan map[string]interface{}, 100),
 		allowReconnect:  false,
 		debug:           false,
-		seq:             0,
-		running:         false,
 		stopChan:        make(chan struct{}),
+		stopOnce:        &sync.Once{},
+		state:           StateClosed,
+		ready:           make(chan struct{}),
+		closing:         make(chan struct{}),
+		done:            make(chan struct{}),
+		inbox:           inbox{notify: make(chan struct{}, 1)},
+
+		httpClient:        &http.Client{Timeout: 10 * time.Minute},
+		requestTimeout:    15 * time.Second,
+		processingTimeout: 5 * time.Minute,
+		missedPongs:       3,
+		reconnectDelay:    2 * time.Second,
+		closeTimeout:      3 * time.Second,
+		redaction:         true,
+		redactFields:      DefaultRedactFields,
+		pending:           make(map[int]chan map[string]interface{}),
+		attachWaiters:     make(map[string]chan map[string]interface{}),
+		videoRequests:     make(map[int]videoRequest),
+		queueTimeout:      time.Second,
 	}
 
 	for _, option := range options {
@@ -56,6 +130,16 @@ func NewChatClient(token, deviceID string, options ...Option) *ChatClient {
 	}
 
 	client.HeaderUserAgent = client.UserAgent
+	if client.logger == nil {
+		if client.debug {
+			client.logger = stdLogger{}
+		} else {
+			client.logger = nopLogger{}
+		}
+	}
+	if client.archiver != nil {
+		client.spawn(client.runArchiver)
+	}
 	return client
 }
 
@@ -74,6 +158,8 @@ func WithUserAgent(userAgent string) Option {
 	}
 }
 
+// WithDebug включает запись отправляемых кадров в лог (уровень Debug)
+// и, если логгер не задан через WithLogger, вывод в стандартный log
 func WithDebug(debug bool) Option {
 	return func(c *ChatClient) {
 		c.debug = debug
@@ -86,108 +172,226 @@ func WithAllowReconnect(allow bool) Option {
 	}
 }
 
-// Connect устанавливает WebSocket соединение
-func (c *ChatClient) Connect() error {
-	if c.allowReconnect {
-		log.Println("[MAXCLIENTAPI] auto reconnect turned on")
+// WithBlockChats задает чаты, сообщения из которых не попадают в очередь
+func WithBlockChats(chats []string) Option {
+	return func(c *ChatClient) {
+		c.blockChats = chats
+	}
+}
+
+// WithBlockSenders задает отправителей, сообщения которых не попадают в очередь
+func WithBlockSenders(senders []string) Option {
+	return func(c *ChatClient) {
+		c.blockSenders = senders
+	}
+}
+
+// WithSenderFilter задает функцию, решающую, пропускать ли сообщение отправителя в очередь
+func WithSenderFilter(filter func(chatID, sender interface{}) bool) Option {
+	return func(c *ChatClient) {
+		c.senderFilter = filter
 	}
-	if c.debug {
-		log.Println("[MAXCLIENTAPI] debug mode is turned on")
+}
+
+// WithPerAttachEvents включает режим совместимости: отдельное событие на каждое вложение
+// (photo, video, file, ...) вместо одного события "message" на сообщение
+func WithPerAttachEvents(enabled bool) Option {
+	return func(c *ChatClient) {
+		c.perAttachEvents = enabled
 	}
+}
+
+// WithHTTPClient задает HTTP клиент для загрузки файлов
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *ChatClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRequestTimeout задает время ожидания ответа сервера на запрос
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *ChatClient) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithProcessingTimeout задает время ожидания обработки загруженного файла на сервере
+func WithProcessingTimeout(timeout time.Duration) Option {
+	return func(c *ChatClient) {
+		c.processingTimeout = timeout
+	}
+}
+
+// Connect устанавливает WebSocket соединение
+func (c *ChatClient) Connect() error {
+	return c.connect(nil)
+}
+
+// connect устанавливает соединение. При переподключении stop — канал остановки,
+// действовавший при разрыве: если клиент за это время остановили, подключения не будет
+func (c *ChatClient) connect(stop chan struct{}) error {
 
 	headers := map[string][]string{
 		"Origin":     {c.Origin},
 		"User-Agent": {c.UserAgent},
 	}
 
-	log.Println("[MAXCLIENTAPI] Trying to connect")
-	
+	c.logger.Info("connecting", "url", c.URL, "reconnect", c.allowReconnect)
+
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	reconnecting := stop != nil
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if c.conn != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-c.done:
+		// Клиент завершил работу после Stop или разрыва соединения, начинаем заново
+		c.done = make(chan struct{})
+		c.doneErr = nil
+	default:
+	}
+	select {
+	case <-c.stopChan:
+		if reconnecting {
+			c.mu.Unlock()
+			return ErrNotConnected
+		}
+		// После Stop клиент можно подключить заново
+		c.stopChan = make(chan struct{})
+		c.stopOnce = &sync.Once{}
+	default:
+	}
+	stop = c.stopChan
+	c.mu.Unlock()
+
+	// Ответы на GetVideoURL, отправленные по прежним соединениям, уже не придут
+	c.dropVideoRequests(int(atomic.LoadInt64(&c.seq)))
+
+	// При переподключении клиент остается в StateReconnecting до установки соединения
+	c.changeState(StateConnecting, func(from State) bool { return from != StateReconnecting })
+
 	dialer := websocket.Dialer{}
 	ws, _, err := dialer.Dial(c.URL, headers)
 	if err != nil {
+		c.changeState(StateClosed, func(from State) bool { return from == StateConnecting })
 		return fmt.Errorf("connection error: %w", err)
 	}
 
-	c.ws = ws
-	c.running = true
-	log.Println("[MAXCLIENTAPI] WebSocket connected")
-
-	go c.listenHandler()
-	c.sendInfo()
+	cn := newConnection(ws)
+	c.mu.Lock()
+	select {
+	case <-stop:
+		// Клиент остановили, пока устанавливалось соединение
+		c.mu.Unlock()
+		ws.Close()
+		return ErrNotConnected
+	default:
+	}
+	c.conn = cn
+	c.connectedAt = time.Now()
+	if reconnecting {
+		atomic.AddUint64(&c.reconnects, 1)
+	}
+	c.watchConnection(cn)
+	c.spawn(func() { c.writeHandler(cn) })
+	c.spawn(func() { c.listenHandler(cn) })
+	c.spawn(func() { c.sendInfo(cn) })
+	c.mu.Unlock()
+	c.logger.Info("websocket connected")
+	c.setState(StateHandshaking)
 
 	return nil
 }
 
 // sendInfo отправляет информацию об устройстве
-func (c *ChatClient) sendInfo() {
-	c.seq++
+func (c *ChatClient) sendInfo(cn *connection) {
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 6,
-		"payload": map[string]interface{}{
-			"userAgent": map[string]interface{}{
-				"deviceType":       "WEB",
-				"locale":           "ru",
-				"deviceLocale":     "ru",
-				"osVersion":        c.OSVersion,
-				"deviceName":       c.DeviceName,
-				"headerUserAgent":  c.HeaderUserAgent,
-				"appVersion":       "25.11.1",
-				"screen":           "1080x1920 1.0x",
-				"timezone":         "Asia/Yekaterinburg",
-			},
-			"deviceId": c.DeviceID,
+		"userAgent": map[string]interface{}{
+			"deviceType":      "WEB",
+			"locale":          "ru",
+			"deviceLocale":    "ru",
+			"osVersion":       c.OSVersion,
+			"deviceName":      c.DeviceName,
+			"headerUserAgent": c.HeaderUserAgent,
+			"appVersion":      "25.11.1",
+			"screen":          "1080x1920 1.0x",
+			"timezone":        "Asia/Yekaterinburg",
 		},
+		"deviceId": c.DeviceID,
 	}
-	c.send(payload, "Info")
-	c.sendHandshake()
+	c.send(6, payload, "Info")
+	c.sendHandshake(cn)
 }
 
-// sendHandshake отправляет handshake
-func (c *ChatClient) sendHandshake() {
-	log.Println("Sending handshake")
-	c.seq++
+// sendHandshake отправляет handshake по соединению cn
+func (c *ChatClient) sendHandshake(cn *connection) {
+	c.logger.Debug("sending handshake")
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 19,
-		"payload": map[string]interface{}{
-			"interactive":   true,
-			"token":         c.Token,
-			"chatsCount":    len(c.WatchChats),
-			"chatsSync":     0,
-			"contactsSync":  0,
-			"presenceSync":  0,
-			"draftsSync":    0,
-		},
+		"interactive":  true,
+		"token":        c.Token,
+		"chatsCount":   len(c.WatchChats),
+		"chatsSync":    0,
+		"contactsSync": 0,
+		"presenceSync": 0,
+		"draftsSync":   0,
+	}
+	start := time.Now()
+	_, err := c.request(19, payload, "Handshake")
+	var serverErr *ServerError
+	switch {
+	case errors.As(err, &serverErr):
+		// Сервер отклонил токен: переподключение не поможет
+		c.logger.Error("handshake rejected", "opcode", 19, "err", err)
+		c.failConnection(cn, err)
+		return
+	case errors.Is(err, ErrTimeout):
+		c.logger.Error("handshake timed out", "opcode", 19, "err", err)
+		c.dropConnection(cn, err)
+		return
+	case err != nil:
+		c.logger.Error("handshake failed", "opcode", 19, "err", err)
+		return
+	}
+	atomic.StoreInt64(&c.handshake, int64(time.Since(start)))
+	// Соединение могло оборваться, пока шел ответ
+	if c.changeState(StateReady, func(from State) bool { return from == StateHandshaking }) {
+		c.subscribeWatchChats()
 	}
-	c.send(payload, "Handshake")
 }
 
-// listenHandler обрабатывает входящие сообщения
-func (c *ChatClient) listenHandler() {
-	defer func() {
-		c.Stop()
-		log.Println("[MAXCLIENTAPI][LISTEN_HANDLER] WebSocket stop")
-	}()
-
-	for c.running {
-		_, message, err := c.ws.ReadMessage()
+// listenHandler обрабатывает входящие сообщения соединения cn
+func (c *ChatClient) listenHandler(cn *connection) {
+	for {
+		_, message, err := cn.ws.ReadMessage()
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-				log.Println("Connection closed")
+				c.logger.Info("connection closed")
 			} else {
-				log.Printf("Read error: %v", err)
+				c.logger.Warn("read failed", "err", err)
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// Истек read deadline: сервер не ответил на WebSocket ping
+				err = fmt.Errorf("%w: %v", ErrDeadConnection, err)
 			}
-			break
+			c.dropConnection(cn, err)
+			c.logger.Debug("listen handler stopped")
+			return
 		}
+		c.extendDeadline(cn)
+		atomic.AddUint64(&c.framesIn, 1)
+		atomic.AddUint64(&c.bytesIn, uint64(len(message)))
 
 		var jsonData map[string]interface{}
 		if err := json.Unmarshal(message, &jsonData); err != nil {
-			log.Printf("JSON parse error: %v", err)
+			c.logger.Warn("json parse failed", "err", err)
 			continue
 		}
 
@@ -201,7 +405,25 @@ func (c *ChatClient) handleMessage(jsonData map[string]interface{}) {
 	if !ok {
 		return
 	}
+	c.opcodeStats.countIn(int(opcode))
+
+	// Ответы на запросы, отправленные через request, не попадают в очередь сообщений
+	if c.resolvePending(jsonData) {
+		return
+	}
 
+	switch int(opcode) {
+	case 136:
+		// Уведомление ждет загрузка, а не потребитель событий
+		c.handleOpcode136(jsonData)
+	case 128, 83, 87:
+		c.dispatch(jsonData)
+	}
+}
+
+// handleEvent обрабатывает кадр, из которого получаются события очереди сообщений
+func (c *ChatClient) handleEvent(jsonData map[string]interface{}) {
+	opcode, _ := jsonData["opcode"].(float64)
 	switch int(opcode) {
 	case 128:
 		c.handleOpcode128(jsonData)
@@ -214,6 +436,50 @@ func (c *ChatClient) handleMessage(jsonData map[string]interface{}) {
 
 // handleOpcode128 обрабатывает сообщения с opcode 128
 func (c *ChatClient) handleOpcode128(jsonData map[string]interface{}) {
+	payload, _ := jsonData["payload"].(map[string]interface{})
+	messageData, _ := payload["message"].(map[string]interface{})
+	if !c.acceptMessage(payload["chatId"], messageData["sender"]) {
+		return
+	}
+	c.archiveMessage(payload, messageData)
+
+	if c.perAttachEvents {
+		c.handleOpcode128PerAttach(jsonData)
+		return
+	}
+
+	text, _ := messageData["text"].(string)
+	attaches, _ := messageData["attaches"].([]interface{})
+	elements, _ := messageData["elements"].([]interface{})
+
+	typed := make([]Attachment, 0, len(attaches))
+	for _, attach := range attaches {
+		attachMap, _ := attach.(map[string]interface{})
+		if a, ok := decodeAttach(attachMap); ok {
+			typed = append(typed, a)
+		}
+	}
+
+	messageInfo := map[string]interface{}{
+		"opcode":        128,
+		"type":          "message",
+		"chat_id":       payload["chatId"],
+		"sender":        messageData["sender"],
+		"text":          text,
+		"elements":      elements,
+		"attaches":      typed,
+		"id":            messageData["id"],
+		"time":          messageData["time"],
+		"utype":         messageData["type"],
+		"prevMessageId": payload["prevMessageId"],
+		"raw":           messageData,
+	}
+	c.emit(messageInfo)
+}
+
+// handleOpcode128PerAttach обрабатывает сообщения с opcode 128 в режиме совместимости,
+// отправляя отдельное событие на каждое вложение
+func (c *ChatClient) handleOpcode128PerAttach(jsonData map[string]interface{}) {
 	payload, _ := jsonData["payload"].(map[string]interface{})
 	messageData, _ := payload["message"].(map[string]interface{})
 	chatID := payload["chatId"]
@@ -234,8 +500,12 @@ func (c *ChatClient) handleOpcode128(jsonData map[string]interface{}) {
 				c.handleVideoAttach(attachMap, chatID, sender, text, messageData, payload)
 			case "FILE":
 				c.handleFileAttach(attachMap, chatID, sender, messageData)
+			case "AUDIO":
+				c.handleAudioAttach(attachMap, chatID, sender, text, messageData, payload)
 			case "SHARE":
 				c.handleShareAttach(chatID, sender, text)
+			case "STICKER", "CONTACT", "LOCATION", "INLINE_KEYBOARD":
+				c.handleTypedAttach(attachMap, chatID, sender, text, messageData, payload)
 			}
 		}
 	} else if len(elements) > 0 {
@@ -253,8 +523,8 @@ func (c *ChatClient) handleOpcode128(jsonData map[string]interface{}) {
 			"utype":         messageData["type"],
 			"prevMessageId": payload["prevMessageId"],
 		}
-		c.messages <- textInfo
-		fmt.Printf("Text from %v: %s\n", sender, text)
+		c.emit(textInfo)
+		c.logger.Debug("text received", "chat_id", chatID, "sender", sender)
 	}
 }
 
@@ -284,12 +554,10 @@ func (c *ChatClient) handlePhotoAttach(attach map[string]interface{}, chatID, se
 
 	if text != "" {
 		mediaInfo["text"] = text
-		fmt.Printf("Photo with text from %v\n", sender)
-	} else {
-		fmt.Printf("Photo from %v\n", sender)
 	}
+	c.logger.Debug("photo received", "chat_id", chatID, "sender", sender)
 
-	c.messages <- mediaInfo
+	c.emit(mediaInfo)
 }
 
 // handleVideoAttach обрабатывает видео вложения
@@ -319,12 +587,10 @@ func (c *ChatClient) handleVideoAttach(attach map[string]interface{}, chatID, se
 
 	if text != "" {
 		mediaInfo["text"] = text
-		fmt.Printf("Video with text from %v\n", sender)
-	} else {
-		fmt.Printf("Video from %v\n", sender)
 	}
+	c.logger.Debug("video received", "chat_id", chatID, "sender", sender)
 
-	c.messages <- mediaInfo
+	c.emit(mediaInfo)
 }
 
 // handleFileAttach обрабатывает файловые вложения
@@ -340,7 +606,33 @@ func (c *ChatClient) handleFileAttach(attach map[string]interface{}, chatID, sen
 		"fileId": attach["fileId"],
 		"token":  attach["token"],
 	}
-	c.messages <- mediaInfo
+	c.emit(mediaInfo)
+}
+
+// handleAudioAttach обрабатывает аудио и голосовые сообщения
+func (c *ChatClient) handleAudioAttach(attach map[string]interface{}, chatID, sender interface{}, text string, messageData, payload map[string]interface{}) {
+	mediaInfo := map[string]interface{}{
+		"opcode":        128,
+		"type":          "audio",
+		"chat_id":       chatID,
+		"sender":        sender,
+		"audioId":       attach["audioId"],
+		"duration":      attach["duration"],
+		"waveform":      decodeWaveform(attach["wave"]),
+		"url":           attach["url"],
+		"token":         attach["token"],
+		"raw":           attach,
+		"id":            messageData["id"],
+		"time":          messageData["time"],
+		"utype":         messageData["type"],
+		"prevMessageId": payload["prevMessageId"],
+	}
+	if text != "" {
+		mediaInfo["text"] = text
+	}
+
+	c.emit(mediaInfo)
+	c.logger.Debug("audio received", "chat_id", chatID, "sender", sender)
 }
 
 // handleShareAttach обрабатывает ссылки
@@ -352,33 +644,38 @@ func (c *ChatClient) handleShareAttach(chatID, sender interface{}, text string)
 		"sender":  sender,
 		"text":    text,
 	}
-	c.messages <- mediaInfo
-	fmt.Printf("Link from %v\n", sender)
+	c.emit(mediaInfo)
+	c.logger.Debug("link received", "chat_id", chatID, "sender", sender)
 }
 
 // handleOpcode83 обрабатывает сообщения с opcode 83
 func (c *ChatClient) handleOpcode83(jsonData map[string]interface{}) {
 	payload, _ := jsonData["payload"].(map[string]interface{})
-	
-	var videoURL interface{}
-	i := 0
-	for _, v := range payload {
-		if i == 2 {
-			videoURL = v
-			break
+	urls := parseVideoURLs(payload)
+
+	// Находим запрос GetVideoURL, на который пришел этот ответ
+	if seq, ok := jsonData["seq"].(float64); ok {
+		c.pendingMu.Lock()
+		if req, ok := c.videoRequests[int(seq)]; ok {
+			urls.VideoID, urls.ChatID, urls.MessageID = req.videoID, req.chatID, req.messageID
+			delete(c.videoRequests, int(seq))
 		}
-		i++
+		c.pendingMu.Unlock()
 	}
 
 	downloadInfo := map[string]interface{}{
-		"opcode":    83,
-		"type":      "download_link",
-		"EXTERNAL":  payload["EXTERNAL"],
-		"video_url": videoURL,
-		"raw":       payload,
-	}
-	c.messages <- downloadInfo
-	log.Println("Gotted url")
+		"opcode":     83,
+		"type":       "download_link",
+		"EXTERNAL":   payload["EXTERNAL"],
+		"video_url":  urls.BestVideoURL(0),
+		"videoId":    urls.VideoID,
+		"chatId":     urls.ChatID,
+		"messageId":  urls.MessageID,
+		"renditions": urls,
+		"raw":        payload,
+	}
+	c.emit(downloadInfo)
+	c.logger.Debug("video urls received", "opcode", 83, "video_id", urls.VideoID)
 }
 
 // handleOpcode87 обрабатывает сообщения с opcode 87
@@ -395,7 +692,7 @@ func (c *ChatClient) handleOpcode87(jsonData map[string]interface{}) {
 			"token":  infoMap["token"],
 			"fileId": infoMap["fileId"],
 		}
-		c.messages <- urlFrom87
+		c.emit(urlFrom87)
 	}
 }
 
@@ -405,200 +702,111 @@ func (c *ChatClient) StartKeepalive(interval time.Duration) {
 		interval = 25 * time.Second
 	}
 
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if !c.running {
-					return
-				}
-				c.seq++
-				pingPayload := map[string]interface{}{
-					"ver":    11,
-					"cmd":    0,
-					"seq":    c.seq,
-					"opcode": 1,
-					"payload": map[string]interface{}{
-						"interactive": false,
-					},
-				}
-				c.send(pingPayload, "")
-			case <-c.stopChan:
-				return
-			}
-		}
-	}()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := c.stopChan
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	c.spawn(func() { c.keepalive(interval, stop) })
 }
 
 // GetMessage получает сообщение из очереди
 func (c *ChatClient) GetMessage() (map[string]interface{}, bool) {
 	select {
-	case msg := <-c.messages:
-		return msg, true
+	case msg, ok := <-c.messages:
+		return msg, ok
 	default:
 		return nil, false
 	}
 }
 
-// GetMessageBlocking получает сообщение из очереди (блокирующий вызов)
+// GetMessageBlocking получает сообщение из очереди (блокирующий вызов).
+// После Close возвращает nil
 func (c *ChatClient) GetMessageBlocking() map[string]interface{} {
 	return <-c.messages
 }
 
+// Messages возвращает канал событий; он закрывается при Close, поэтому его можно читать через range
+func (c *ChatClient) Messages() <-chan map[string]interface{} {
+	return c.messages
+}
+
 // SendMessage отправляет текстовое сообщение
 func (c *ChatClient) SendMessage(chatID interface{}, text string) {
-	c.seq++
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 64,
-		"payload": map[string]interface{}{
-			"chatId": chatID,
-			"message": map[string]interface{}{
-				"text":     text,
-				"cid":      time.Now().UnixMilli(),
-				"elements": []interface{}{},
-				"attaches": []interface{}{},
-			},
-			"notify": true,
+		"chatId": chatID,
+		"message": map[string]interface{}{
+			"text":     text,
+			"cid":      time.Now().UnixMilli(),
+			"elements": []interface{}{},
+			"attaches": []interface{}{},
 		},
+		"notify": true,
 	}
-	c.send(payload, "Message")
+	c.send(64, payload, "Message")
 
-	c.seq++
 	payload1 := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 177,
-		"payload": map[string]interface{}{
-			"chatId": chatID,
-			"time":   0,
-		},
+		"chatId": chatID,
+		"time":   0,
 	}
-	c.send(payload1, "")
+	c.send(177, payload1, "")
 }
 
 // GetVideoURL запрашивает URL видео
 func (c *ChatClient) GetVideoURL(videoID, chatID, messageID interface{}) {
-	c.seq++
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 83,
-		"payload": map[string]interface{}{
-			"videoId":   videoID,
-			"chatId":    chatID,
-			"messageId": messageID,
-		},
-	}
-	c.send(payload, "Get video URL")
+		"videoId":   videoID,
+		"chatId":    chatID,
+		"messageId": messageID,
+	}
+	// Запоминаем запрос до отправки, чтобы связать с ним ответ в handleOpcode83
+	c.sendWithSeq(83, payload, "Get video URL", func(seq int) {
+		c.dropVideoRequests(0)
+		c.pendingMu.Lock()
+		c.videoRequests[seq] = videoRequest{
+			videoID:   videoID,
+			chatID:    chatID,
+			messageID: messageID,
+			expires:   time.Now().Add(c.requestTimeout),
+		}
+		c.pendingMu.Unlock()
+	})
 }
 
 // SubscribeChat подписывается на чат
 func (c *ChatClient) SubscribeChat(chatID interface{}) {
-	c.seq++
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 75,
-		"payload": map[string]interface{}{
-			"chatId":    chatID,
-			"subscribe": true,
-		},
+		"chatId":    chatID,
+		"subscribe": true,
 	}
-	c.send(payload, "Subscribe chat")
+	c.send(75, payload, "Subscribe chat")
 }
 
 // RequestURLToSendFile запрашивает URL для отправки файла
 func (c *ChatClient) RequestURLToSendFile(count int) {
-	c.seq++
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 87,
-		"payload": map[string]interface{}{
-			"count": count,
-		},
+		"count": count,
 	}
-	c.send(payload, "Request URL to send file")
+	c.send(87, payload, "Request URL to send file")
 }
 
 // SendFile отправляет файл
 func (c *ChatClient) SendFile(chatID, fileID interface{}) {
-	c.seq++
 	payload := map[string]interface{}{
-		"ver":    11,
-		"cmd":    0,
-		"seq":    c.seq,
-		"opcode": 64,
-		"payload": map[string]interface{}{
-			"chatId": chatID,
-			"message": map[string]interface{}{
-				"cid": time.Now().UnixMilli(),
-				"attaches": []interface{}{
-					map[string]interface{}{
-						"_type":  "FILE",
-						"fileId": fileID,
-					},
+		"chatId": chatID,
+		"message": map[string]interface{}{
+			"cid": time.Now().UnixMilli(),
+			"attaches": []interface{}{
+				map[string]interface{}{
+					"_type":  "FILE",
+					"fileId": fileID,
 				},
 			},
-			"notify": true,
 		},
+		"notify": true,
 	}
-	c.send(payload, "File")
+	c.send(64, payload, "File")
 }
-
-// send отправляет данные через WebSocket
-func (c *ChatClient) send(data map[string]interface{}, sendType string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.ws == nil {
-		log.Println("[MAXCLIENTAPI] WebSocket connection is closed")
-		c.Stop()
-		if c.allowReconnect {
-			go func() {
-				time.Sleep(2 * time.Second)
-				c.Connect()
-				c.StartKeepalive(25 * time.Second)
-			}()
-		}
-		return
-	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("[ERROR]: %v", err)
-		return
-	}
-
-	err = c.ws.WriteMessage(websocket.TextMessage, jsonData)
-	if err != nil {
-		log.Printf("[ERROR]: %v", err)
-		return
-	}
-
-	if c.debug {
-		log.Printf("[MAXCLIENTAPI] The %s successfully sent", sendType)
-		log.Printf("[MAXCLIENTAPI] Data: %s", string(jsonData))
-	} else if sendType != "" {
-		log.Printf("[MAXCLIENTAPI] The %s successfully sent", sendType)
-	}
-}
-
-// Stop останавливает клиент
-func (c *ChatClient) Stop() {
-	c.running = false
-	close(c.stopChan)
-	if c.ws != nil {
-		c.ws.Close()
-	}
-}
\ No newline at end of file
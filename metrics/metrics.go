@@ -0,0 +1,205 @@
+// Package metrics отдает статистику клиентов maxclientapi в формате OpenMetrics,
+// который понимает Prometheus. Пакет не зависит от клиентской библиотеки Prometheus.
+//
+//	exporter := metrics.NewExporter()
+//	exporter.Add("support-bot", client)
+//	http.Handle("/metrics", exporter)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	maxclientapi "github.com/arsrus721/maxclientapi-go"
+)
+
+// ContentType — тип содержимого ответа Exporter
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Exporter — http.Handler с метриками зарегистрированных клиентов.
+// Каждый клиент помечается меткой client
+type Exporter struct {
+	mu      sync.Mutex
+	clients map[string]*maxclientapi.ChatClient
+}
+
+// NewExporter создает пустой Exporter
+func NewExporter() *Exporter {
+	return &Exporter{clients: make(map[string]*maxclientapi.ChatClient)}
+}
+
+// Handler возвращает Exporter с одним клиентом под именем "default"
+func Handler(client *maxclientapi.ChatClient) http.Handler {
+	exporter := NewExporter()
+	exporter.Add("default", client)
+	return exporter
+}
+
+// Add регистрирует клиент под именем name, заменяя прежний с тем же именем
+func (e *Exporter) Add(name string, client *maxclientapi.ChatClient) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clients[name] = client
+}
+
+// Remove убирает клиент из экспорта
+func (e *Exporter) Remove(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.clients, name)
+}
+
+type snapshot struct {
+	name  string
+	ready bool
+	stats maxclientapi.Stats
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	snapshots := make([]snapshot, 0, len(e.clients))
+	for name, client := range e.clients {
+		snapshots = append(snapshots, snapshot{
+			name:  name,
+			ready: client.State() == maxclientapi.StateReady,
+			stats: client.Stats(),
+		})
+	}
+	e.mu.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].name < snapshots[j].name })
+
+	w.Header().Set("Content-Type", ContentType)
+	out := bufio.NewWriter(w)
+	write(out, snapshots)
+	out.Flush()
+}
+
+// write выводит метрики; сэмплы одного семейства должны идти подряд
+func write(w *bufio.Writer, snapshots []snapshot) {
+	family(w, "maxclient_ready", "gauge", "1 if the session is authenticated.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_ready", s.name, nil, boolValue(s.ready))
+	}
+
+	family(w, "maxclient_frames", "counter", "Protocol frames by direction and opcode.")
+	for _, s := range snapshots {
+		for _, opcode := range sortedOpcodes(s.stats.FramesInByOpcode) {
+			sample(w, "maxclient_frames_total", s.name, []string{"direction", "in", "opcode", strconv.Itoa(opcode)},
+				float64(s.stats.FramesInByOpcode[opcode]))
+		}
+		for _, opcode := range sortedOpcodes(s.stats.FramesOutByOpcode) {
+			sample(w, "maxclient_frames_total", s.name, []string{"direction", "out", "opcode", strconv.Itoa(opcode)},
+				float64(s.stats.FramesOutByOpcode[opcode]))
+		}
+	}
+
+	family(w, "maxclient_websocket_bytes", "counter", "WebSocket payload bytes by direction.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_websocket_bytes_total", s.name, []string{"direction", "in"}, float64(s.stats.BytesIn))
+		sample(w, "maxclient_websocket_bytes_total", s.name, []string{"direction", "out"}, float64(s.stats.BytesOut))
+	}
+
+	family(w, "maxclient_send_errors", "counter", "Failed sends and requests by error code.")
+	for _, s := range snapshots {
+		codes := make([]string, 0, len(s.stats.SendErrors))
+		for code := range s.stats.SendErrors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			sample(w, "maxclient_send_errors_total", s.name, []string{"code", code}, float64(s.stats.SendErrors[code]))
+		}
+	}
+
+	family(w, "maxclient_queue_depth", "gauge", "Events waiting to be read, including spilled to disk.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_queue_depth", s.name, nil, float64(s.stats.QueueDepth))
+	}
+
+	family(w, "maxclient_dropped_events", "counter", "Events dropped because the queue was full.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_dropped_events_total", s.name, nil, float64(s.stats.DroppedEvents))
+	}
+
+	family(w, "maxclient_reconnects", "counter", "Successful reconnects.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_reconnects_total", s.name, nil, float64(s.stats.Reconnects))
+	}
+
+	family(w, "maxclient_transfer_bytes", "counter", "File bytes uploaded and downloaded over HTTP.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_transfer_bytes_total", s.name, []string{"direction", "upload"}, float64(s.stats.UploadedBytes))
+		sample(w, "maxclient_transfer_bytes_total", s.name, []string{"direction", "download"}, float64(s.stats.DownloadedBytes))
+	}
+
+	family(w, "maxclient_handshake_latency_seconds", "gauge", "Latency of the last handshake.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_handshake_latency_seconds", s.name, nil, seconds(s.stats.HandshakeLatency))
+	}
+
+	family(w, "maxclient_rtt_seconds", "gauge", "Keepalive round-trip time percentiles over recent pings.")
+	for _, s := range snapshots {
+		if s.stats.RTTSamples == 0 {
+			continue
+		}
+		sample(w, "maxclient_rtt_seconds", s.name, []string{"percentile", "50"}, seconds(s.stats.RTTP50))
+		sample(w, "maxclient_rtt_seconds", s.name, []string{"percentile", "99"}, seconds(s.stats.RTTP99))
+	}
+
+	family(w, "maxclient_uptime_seconds", "gauge", "Time since the current connection was established.")
+	for _, s := range snapshots {
+		sample(w, "maxclient_uptime_seconds", s.name, nil, seconds(s.stats.Uptime))
+	}
+
+	w.WriteString("# EOF\n")
+}
+
+func family(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, kind, name, help)
+}
+
+// sample выводит строку метрики; labels — пары имя, значение
+func sample(w *bufio.Writer, name, client string, labels []string, value float64) {
+	w.WriteString(name)
+	w.WriteString(`{client="`)
+	w.WriteString(escape(client))
+	w.WriteByte('"')
+	for i := 0; i+1 < len(labels); i += 2 {
+		fmt.Fprintf(w, `,%s="%s"`, labels[i], escape(labels[i+1]))
+	}
+	w.WriteString("} ")
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func sortedOpcodes(counts map[int]uint64) []int {
+	opcodes := make([]int, 0, len(counts))
+	for opcode := range counts {
+		opcodes = append(opcodes, opcode)
+	}
+	sort.Ints(opcodes)
+	return opcodes
+}
+
+func seconds(d time.Duration) float64 {
+	return d.Seconds()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	maxclientapi "github.com/arsrus721/maxclientapi-go"
+)
+
+func exposition(snapshots []snapshot) string {
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+	write(out, snapshots)
+	out.Flush()
+	return buf.String()
+}
+
+func TestExposition(t *testing.T) {
+	text := exposition([]snapshot{
+		{
+			name:  "bot",
+			ready: true,
+			stats: maxclientapi.Stats{
+				RTTP50:            20 * time.Millisecond,
+				RTTP99:            250 * time.Millisecond,
+				RTTSamples:        10,
+				BytesIn:           1024,
+				BytesOut:          512,
+				FramesInByOpcode:  map[int]uint64{128: 5, 1: 7},
+				FramesOutByOpcode: map[int]uint64{1: 7},
+				SendErrors:        map[string]uint64{"timeout": 2, `bad"code\`: 1},
+				UploadedBytes:     100,
+				DownloadedBytes:   200,
+				Reconnects:        3,
+				DroppedEvents:     4,
+				QueueDepth:        6,
+				HandshakeLatency:  1500 * time.Millisecond,
+				Uptime:            time.Minute,
+			},
+		},
+		{name: "say \"hi\"\n\\", stats: maxclientapi.Stats{}},
+	})
+
+	for _, line := range []string{
+		`maxclient_ready{client="bot"} 1`,
+		`maxclient_frames_total{client="bot",direction="in",opcode="1"} 7`,
+		`maxclient_frames_total{client="bot",direction="in",opcode="128"} 5`,
+		`maxclient_frames_total{client="bot",direction="out",opcode="1"} 7`,
+		`maxclient_websocket_bytes_total{client="bot",direction="in"} 1024`,
+		`maxclient_send_errors_total{client="bot",code="bad\"code\\"} 1`,
+		`maxclient_send_errors_total{client="bot",code="timeout"} 2`,
+		`maxclient_queue_depth{client="bot"} 6`,
+		`maxclient_dropped_events_total{client="bot"} 4`,
+		`maxclient_reconnects_total{client="bot"} 3`,
+		`maxclient_transfer_bytes_total{client="bot",direction="download"} 200`,
+		`maxclient_handshake_latency_seconds{client="bot"} 1.5`,
+		`maxclient_rtt_seconds{client="bot",percentile="99"} 0.25`,
+		`maxclient_uptime_seconds{client="bot"} 60`,
+		`maxclient_ready{client="say \"hi\"\n\\"} 0`,
+	} {
+		if !strings.Contains(text, "\n"+line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	if strings.Contains(text, `maxclient_rtt_seconds{client="say`) {
+		t.Error("rtt is exported for a client without samples")
+	}
+
+	if !strings.HasSuffix(text, "\n# EOF\n") || strings.Count(text, "# EOF") != 1 {
+		t.Error("exposition does not end with a single # EOF")
+	}
+
+	// Сэмплы идут сразу после своего семейства, у counter — с суффиксом _total
+	seen := map[string]bool{}
+	var family, kind string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		switch {
+		case line == "# EOF":
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(line)
+			family, kind = fields[2], fields[3]
+			if seen[family] {
+				t.Errorf("family %s is not grouped", family)
+			}
+			seen[family] = true
+		case strings.HasPrefix(line, "# HELP "):
+			if fields := strings.Fields(line); fields[2] != family {
+				t.Errorf("HELP for %s inside %s", fields[2], family)
+			}
+		default:
+			name := line[:strings.IndexByte(line, '{')]
+			want := family
+			if kind == "counter" {
+				want += "_total"
+			}
+			if name != want {
+				t.Errorf("sample %s in family %s (%s)", name, family, kind)
+			}
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	client := maxclientapi.NewChatClient("token", "device")
+	recorder := httptest.NewRecorder()
+	Handler(client).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := recorder.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "\nmaxclient_ready{client=\"default\"} 0\n") {
+		t.Errorf("ready sample is missing:\n%s", body)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("body does not end with # EOF")
+	}
+
+	exporter := NewExporter()
+	exporter.Add("a", client)
+	exporter.Add("b", client)
+	exporter.Remove("a")
+	recorder = httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if body := recorder.Body.String(); strings.Contains(body, `client="a"`) || !strings.Contains(body, `client="b"`) {
+		t.Errorf("Remove did not update the export:\n%s", body)
+	}
+}
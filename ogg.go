@@ -0,0 +1,82 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrNotOpus возвращается, если данные не являются потоком Ogg/Opus
+var ErrNotOpus = errors.New("maxclientapi: not an ogg/opus stream")
+
+// Opus всегда использует частоту 48 кГц для granule position
+const opusSampleRate = 48000
+
+// oggOpusDuration вычисляет длительность Ogg/Opus потока по granule position
+// последней страницы с учетом pre-skip из заголовка OpusHead
+func oggOpusDuration(data []byte) (time.Duration, error) {
+	var (
+		serial      uint32
+		preSkip     uint16
+		lastGranule int64 = -1
+		found       bool
+	)
+
+	for len(data) >= 27 {
+		if !bytes.Equal(data[:4], []byte("OggS")) {
+			return 0, ErrNotOpus
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[6:14]))
+		pageSerial := binary.LittleEndian.Uint32(data[14:18])
+		segments := int(data[26])
+		if len(data) < 27+segments {
+			break
+		}
+
+		bodySize := 0
+		for _, lacing := range data[27 : 27+segments] {
+			bodySize += int(lacing)
+		}
+		body := data[27+segments:]
+		if len(body) < bodySize {
+			break
+		}
+		body = body[:bodySize]
+
+		if !found {
+			if len(body) >= 19 && bytes.Equal(body[:8], []byte("OpusHead")) {
+				found = true
+				serial = pageSerial
+				preSkip = binary.LittleEndian.Uint16(body[10:12])
+			}
+		} else if pageSerial == serial && granule >= 0 {
+			lastGranule = granule
+		}
+
+		data = data[27+segments+bodySize:]
+	}
+
+	if !found {
+		return 0, ErrNotOpus
+	}
+	if lastGranule < int64(preSkip) {
+		return 0, nil
+	}
+	samples := lastGranule - int64(preSkip)
+	return time.Duration(samples) * time.Second / opusSampleRate, nil
+}
+
+// decodeWaveform декодирует поле wave голосового сообщения
+func decodeWaveform(wave interface{}) []byte {
+	encoded, ok := wave.(string)
+	if !ok || encoded == "" {
+		return nil
+	}
+	waveform, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return waveform
+}
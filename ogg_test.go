@@ -0,0 +1,47 @@
+package maxclientapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOggOpusDuration(t *testing.T) {
+	vorbis := oggPage(1, 0, []byte("\x01vorbis\x00\x00\x00\x00\x02\x44\xac\x00\x00"))
+	head := []byte("OpusHead\x01\x01\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+
+	// Страницы другого логического потока не учитываются
+	mixed := opusStream(2)
+	mixed = append(mixed, oggPage(2, 10*opusSampleRate, make([]byte, 10))...)
+
+	// Последняя страница обрезана: длительность берется по предыдущей
+	truncated := opusStream(2)
+	truncated = append(truncated, oggPage(1, 5*opusSampleRate+312, make([]byte, 300))[:100]...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want time.Duration
+		err  error
+	}{
+		{"three seconds", opusStream(3), 3 * time.Second, nil},
+		{"fraction", append(oggPage(1, 0, head), oggPage(1, opusSampleRate/2+312, nil)...), 500 * time.Millisecond, nil},
+		{"other stream", mixed, 2 * time.Second, nil},
+		{"truncated page", truncated, 2 * time.Second, nil},
+		{"granule below pre-skip", append(oggPage(1, 0, head), oggPage(1, 100, nil)...), 0, nil},
+		{"only header", oggPage(1, 0, head), 0, nil},
+		{"vorbis", vorbis, 0, ErrNotOpus},
+		{"not ogg", []byte("RIFF\x00\x00\x00\x00WAVEfmt plus some padding"), 0, ErrNotOpus},
+		{"empty", nil, 0, ErrNotOpus},
+	}
+	for _, tt := range tests {
+		got, err := oggOpusDuration(tt.data)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: duration = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"strings"
+)
+
+// ErrNoPreview возвращается, если у фото нет встроенного превью
+var ErrNoPreview = errors.New("maxclientapi: photo has no preview data")
+
+// PhotoSize задает вариант размера фото (значение параметра fn в baseUrl)
+type PhotoSize string
+
+const (
+	PhotoPreview  PhotoSize = "sqr_288"
+	PhotoMedium   PhotoSize = "w_720"
+	PhotoOriginal PhotoSize = ""
+)
+
+// PhotoURL возвращает ссылку на фото нужного размера. Для PhotoOriginal
+// параметр размера удаляется из baseUrl
+func (p Photo) PhotoURL(size PhotoSize) string {
+	u, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return p.BaseURL
+	}
+	query := u.Query()
+	if size == PhotoOriginal {
+		query.Del("fn")
+	} else {
+		query.Set("fn", string(size))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Preview декодирует встроенное в previewData превью (data URI) для быстрой отрисовки.
+// Поддерживаются форматы, зарегистрированные в пакете image: JPEG, PNG и GIF,
+// а также WebP после импорта golang.org/x/image/webp
+func (p Photo) Preview() (image.Image, error) {
+	data := p.PreviewData
+	if data == "" {
+		return nil, ErrNoPreview
+	}
+	if strings.HasPrefix(data, "data:") {
+		i := strings.Index(data, ",")
+		if i < 0 {
+			return nil, ErrNoPreview
+		}
+		data = data[i+1:]
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	return img, err
+}
@@ -0,0 +1,121 @@
+package maxclientapi
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Progress описывает состояние загрузки или скачивания
+type Progress struct {
+	Name           string
+	Transferred    int64
+	Total          int64 // -1, если размер неизвестен
+	BytesPerSecond float64
+	Done           bool
+}
+
+// ProgressFunc вызывается по мере передачи данных
+type ProgressFunc func(Progress)
+
+// ProgressChan превращает канал в ProgressFunc. Отправка никогда не блокирует передачу:
+// если получатель не успевает, значения пропускаются. Последнее место в буфере канала
+// остается для значения с Done, поэтому при буферизованном канале оно доходит всегда,
+// а при небуферизованном — только если получатель в этот момент ждет
+func ProgressChan(ch chan<- Progress) ProgressFunc {
+	return func(p Progress) {
+		if !p.Done && cap(ch) > 0 && len(ch) >= cap(ch)-1 {
+			return
+		}
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// progressInterval ограничивает частоту вызова ProgressFunc
+const progressInterval = 200 * time.Millisecond
+
+// progressTracker считает переданные байты и скорость
+type progressTracker struct {
+	fn         ProgressFunc
+	name       string
+	total      int64
+	start      time.Time
+	lastReport time.Time
+	base       int64 // байты, переданные до начала отслеживания (докачка)
+	current    int64
+}
+
+func newProgressTracker(fn ProgressFunc, name string, total, base int64) *progressTracker {
+	now := time.Now()
+	return &progressTracker{fn: fn, name: name, total: total, start: now, base: base, current: base}
+}
+
+func (t *progressTracker) add(n int) {
+	t.current += int64(n)
+	if time.Since(t.lastReport) >= progressInterval {
+		t.report(false)
+	}
+}
+
+func (t *progressTracker) report(done bool) {
+	t.lastReport = time.Now()
+	speed := 0.0
+	if elapsed := time.Since(t.start).Seconds(); elapsed > 0 {
+		speed = float64(t.current-t.base) / elapsed
+	}
+	t.fn(Progress{
+		Name:           t.name,
+		Transferred:    t.current,
+		Total:          t.total,
+		BytesPerSecond: speed,
+		Done:           done,
+	})
+}
+
+type progressReader struct {
+	r       io.Reader
+	tracker *progressTracker
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.tracker.add(n)
+	if err == io.EOF {
+		p.tracker.report(true)
+	}
+	return n, err
+}
+
+type progressWriter struct {
+	w       io.Writer
+	tracker *progressTracker
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.tracker.add(n)
+	return n, err
+}
+
+// readerSize пытается определить размер данных без чтения; -1, если неизвестен
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,38 @@
+package maxclientapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressChanDoesNotBlock(t *testing.T) {
+	for _, size := range []int{0, 1, 3} {
+		ch := make(chan Progress, size)
+		fn := ProgressChan(ch)
+
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10; i++ {
+				fn(Progress{Transferred: int64(i)})
+			}
+			fn(Progress{Transferred: 10, Done: true})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("buffer %d: ProgressChan blocks without a reader", size)
+		}
+
+		if size == 0 {
+			continue
+		}
+		var last Progress
+		for len(ch) > 0 {
+			last = <-ch
+		}
+		if !last.Done {
+			t.Fatalf("buffer %d: Done is not delivered, last %+v", size, last)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueuePolicy определяет, что делать с событием, если очередь сообщений заполнена
+type QueuePolicy int
+
+const (
+	// QueueBlock ждет, пока потребитель освободит место (поведение по умолчанию).
+	// Чтение соединения при этом не останавливается: ответы на запросы и пинги
+	// обрабатываются сразу, а входящие события ждут в памяти
+	QueueBlock QueuePolicy = iota
+	// QueueDropNewest отбрасывает новое событие
+	QueueDropNewest
+	// QueueDropOldest отбрасывает самое старое событие в очереди
+	QueueDropOldest
+	// QueueBlockTimeout ждет не дольше WithQueueTimeout, затем отбрасывает событие
+	QueueBlockTimeout
+	// QueueSpillToDisk сохраняет события, не поместившиеся в очередь, во временный файл
+	QueueSpillToDisk
+)
+
+// WithQueue задает размер очереди сообщений и политику при ее заполнении.
+// Размер меньше 1 заменяется на 1: без буфера политики отбрасывания теряли бы все события
+func WithQueue(size int, policy QueuePolicy) Option {
+	return func(c *ChatClient) {
+		if size < 1 {
+			size = 1
+		}
+		c.messages = make(chan map[string]interface{}, size)
+		c.queuePolicy = policy
+	}
+}
+
+// WithQueueTimeout задает время ожидания для QueueBlockTimeout
+func WithQueueTimeout(timeout time.Duration) Option {
+	return func(c *ChatClient) {
+		c.queueTimeout = timeout
+	}
+}
+
+// WithSpillDir задает каталог временного файла для QueueSpillToDisk
+// (по умолчанию os.TempDir())
+func WithSpillDir(dir string) Option {
+	return func(c *ChatClient) {
+		c.spillDir = dir
+	}
+}
+
+// DroppedEvents возвращает число событий, отброшенных из-за заполненной очереди
+func (c *ChatClient) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// QueueDepth возвращает число событий, ожидающих чтения, включая сохраненные на диск
+// и еще не обработанные входящие кадры
+func (c *ChatClient) QueueDepth() int {
+	c.mu.Lock()
+	spill := c.spill
+	c.mu.Unlock()
+
+	depth := len(c.messages) + c.inbox.len()
+	if spill != nil {
+		depth += spill.len()
+	}
+	return depth
+}
+
+// emit помещает событие в очередь сообщений согласно политике
+func (c *ChatClient) emit(event map[string]interface{}) {
+	switch c.queuePolicy {
+	case QueueDropNewest:
+		select {
+		case c.messages <- event:
+		default:
+			c.drop(event)
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case c.messages <- event:
+				return
+			default:
+			}
+			select {
+			case old := <-c.messages:
+				c.drop(old)
+			default:
+			}
+		}
+	case QueueBlockTimeout:
+		timer := time.NewTimer(c.queueTimeout)
+		defer timer.Stop()
+		select {
+		case c.messages <- event:
+		case <-timer.C:
+			c.drop(event)
+		case <-c.closing:
+			c.drop(event)
+		}
+	case QueueSpillToDisk:
+		c.spillEmit(event)
+	default:
+		// После Close потребитель может больше не читать очередь
+		select {
+		case c.messages <- event:
+		case <-c.closing:
+			c.drop(event)
+		}
+	}
+}
+
+func (c *ChatClient) drop(event map[string]interface{}) {
+	atomic.AddUint64(&c.dropped, 1)
+	c.logger.Debug("queue is full, event dropped", "type", event["type"])
+}
+
+// spillEmit кладет событие в очередь или, если она заполнена или сохраненные
+// события еще не доставлены (чтобы сохранить порядок), во временный файл
+func (c *ChatClient) spillEmit(event map[string]interface{}) {
+	c.spillOnce.Do(func() {
+		c.mu.Lock()
+		c.spill = &spillQueue{dir: c.spillDir, notify: make(chan struct{}, 1)}
+		c.mu.Unlock()
+		c.spawn(c.spillPump)
+	})
+
+	if c.spill.len() == 0 {
+		select {
+		case c.messages <- event:
+			return
+		default:
+		}
+	}
+	if err := c.spill.push(event); err != nil {
+		c.logger.Error("spill failed", "err", err)
+		c.drop(event)
+	}
+}
+
+// spillPump переносит события из файла в очередь по мере ее освобождения
+func (c *ChatClient) spillPump() {
+	for {
+		select {
+		case <-c.spill.notify:
+		case <-c.closing:
+			return
+		}
+		for {
+			event, ok, err := c.spill.pop()
+			if err != nil {
+				c.logger.Error("spill read failed", "err", err)
+				c.drop(nil)
+				continue
+			}
+			if !ok {
+				break
+			}
+			select {
+			case c.messages <- event:
+				c.spill.delivered()
+			case <-c.closing:
+				return
+			}
+		}
+	}
+}
+
+// spillQueue — очередь событий в файле: записи вида [длина][gob]
+type spillQueue struct {
+	dir    string
+	notify chan struct{}
+
+	mu          sync.Mutex
+	file        *os.File
+	readOffset  int64
+	writeOffset int64
+	count       int
+	// inflight — событие прочитано из файла, но еще не передано в очередь
+	inflight int
+}
+
+// len возвращает число недоставленных событий, включая прочитанное pop
+func (q *spillQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count + q.inflight
+}
+
+// delivered отмечает, что событие, полученное из pop, передано в очередь
+func (q *spillQueue) delivered() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inflight--
+}
+
+// close закрывает временный файл
+func (q *spillQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	q.count = 0
+	q.readOffset = 0
+	q.writeOffset = 0
+}
+
+func (q *spillQueue) push(event map[string]interface{}) error {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	if err := gob.NewEncoder(&buf).Encode(event); err != nil {
+		return err
+	}
+	record := buf.Bytes()
+	binary.BigEndian.PutUint32(record, uint32(len(record)-4))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		file, err := os.CreateTemp(q.dir, "maxclientapi-spill-*")
+		if err != nil {
+			return err
+		}
+		// Файл нужен только этому процессу
+		os.Remove(file.Name())
+		q.file = file
+	}
+	if _, err := q.file.WriteAt(record, q.writeOffset); err != nil {
+		return err
+	}
+	q.writeOffset += int64(len(record))
+	q.count++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *spillQueue) pop() (map[string]interface{}, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count == 0 {
+		return nil, false, nil
+	}
+
+	var size [4]byte
+	if _, err := q.file.ReadAt(size[:], q.readOffset); err != nil {
+		return nil, false, q.reset(err)
+	}
+	record := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := q.file.ReadAt(record, q.readOffset+4); err != nil {
+		return nil, false, q.reset(err)
+	}
+	q.readOffset += int64(4 + len(record))
+	q.count--
+	if q.count == 0 {
+		q.truncate()
+	}
+
+	var event map[string]interface{}
+	if err := gob.NewDecoder(bytes.NewReader(record)).Decode(&event); err != nil {
+		return nil, false, err
+	}
+	q.inflight++
+	return event, true, nil
+}
+
+// reset отбрасывает содержимое файла, если его не удалось прочитать
+func (q *spillQueue) reset(err error) error {
+	q.count = 0
+	q.truncate()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (q *spillQueue) truncate() {
+	q.readOffset = 0
+	q.writeOffset = 0
+	q.file.Truncate(0)
+}
+
+func init() {
+	// Типы, которые встречаются в событиях и должны переживать запись на диск
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register([]Attachment{})
+	gob.Register([]byte{})
+	gob.Register(&VideoURLs{})
+	gob.Register(Photo{})
+	gob.Register(Video{})
+	gob.Register(File{})
+	gob.Register(Audio{})
+	gob.Register(Share{})
+	gob.Register(Sticker{})
+	gob.Register(Contact{})
+	gob.Register(Location{})
+	gob.Register(InlineKeyboard{})
+	gob.Register(UnknownAttach{})
+}
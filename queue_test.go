@@ -0,0 +1,154 @@
+package maxclientapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueSizeBelowOne(t *testing.T) {
+	for _, size := range []int{0, -5} {
+		c := NewChatClient("token", "device", WithQueue(size, QueueDropOldest))
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10; i++ {
+				c.emit(map[string]interface{}{"n": i})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("size %d: emit does not return", size)
+		}
+		if event, ok := c.GetMessage(); !ok || event["n"] != 9 {
+			t.Fatalf("size %d: got %v, want the newest event", size, event)
+		}
+		if got := c.DroppedEvents(); got != 9 {
+			t.Fatalf("size %d: dropped %d, want 9", size, got)
+		}
+	}
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	c := NewChatClient("token", "device", WithQueue(2, QueueDropNewest))
+	for i := 0; i < 5; i++ {
+		c.emit(map[string]interface{}{"n": i})
+	}
+	for want := 0; want < 2; want++ {
+		if event, _ := c.GetMessage(); event["n"] != want {
+			t.Fatalf("got %v, want %d", event, want)
+		}
+	}
+	if got := c.DroppedEvents(); got != 3 {
+		t.Fatalf("dropped %d, want 3", got)
+	}
+}
+
+func TestQueueSpillKeepsOrder(t *testing.T) {
+	c := NewChatClient("token", "device", WithQueue(2, QueueSpillToDisk), WithSpillDir(t.TempDir()))
+
+	const total = 3000
+	received := make(chan []int)
+	go func() {
+		var got []int
+		for len(got) < total {
+			event := c.GetMessageBlocking()
+			got = append(got, event["n"].(int))
+			if len(got)%100 == 0 {
+				// Медленный потребитель, чтобы события уходили на диск
+				time.Sleep(time.Millisecond)
+			}
+		}
+		received <- got
+	}()
+
+	for i := 0; i < total; i++ {
+		c.emit(map[string]interface{}{"n": i})
+	}
+
+	select {
+	case got := <-received:
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("event %d has n=%d: order is broken", i, n)
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("events were not delivered")
+	}
+	if c.DroppedEvents() != 0 {
+		t.Fatalf("dropped %d events", c.DroppedEvents())
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.spill.file != nil {
+		t.Fatal("spill file is not closed")
+	}
+}
+
+func TestSpillQueueCountsInflight(t *testing.T) {
+	q := &spillQueue{dir: t.TempDir(), notify: make(chan struct{}, 1)}
+	defer q.close()
+
+	if err := q.push(map[string]interface{}{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	event, ok, err := q.pop()
+	if err != nil || !ok || event["n"] != 1 {
+		t.Fatalf("pop = %v, %v, %v", event, ok, err)
+	}
+	// Пока событие не передано в очередь, новые события должны идти через файл
+	if q.len() != 1 {
+		t.Fatalf("len = %d before delivery, want 1", q.len())
+	}
+	q.delivered()
+	if q.len() != 0 {
+		t.Fatalf("len = %d after delivery, want 0", q.len())
+	}
+}
+
+func TestSlowConsumerDoesNotBlockReplies(t *testing.T) {
+	server := newTestServer(t)
+	c := server.client(WithRequestTimeout(2 * time.Second))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	// Очередь на 100 событий переполнена, потребитель ничего не читает
+	const total = 300
+	for i := 0; i < total; i++ {
+		server.push(map[string]interface{}{"ver": 11, "cmd": 0, "seq": 0, "opcode": 128, "payload": map[string]interface{}{
+			"chatId":  1,
+			"message": map[string]interface{}{"id": i, "sender": 2, "text": "burst"},
+		}})
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.QueueDepth() < total {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", c.QueueDepth(), total)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := c.request(49, map[string]interface{}{}, ""); err != nil {
+		t.Fatalf("request with a full queue: %v", err)
+	}
+	if err := c.ping(time.Second); err != nil {
+		t.Fatalf("ping with a full queue: %v", err)
+	}
+
+	for i := 0; i < total; i++ {
+		event := c.GetMessageBlocking()
+		if event["id"] != float64(i) {
+			t.Fatalf("event %d has id %v: order is broken", i, event["id"])
+		}
+	}
+	if c.DroppedEvents() != 0 {
+		t.Fatalf("dropped %d events", c.DroppedEvents())
+	}
+}
@@ -0,0 +1,74 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// DefaultRedactFields — поля, значения которых скрываются в логах кадров по умолчанию
+var DefaultRedactFields = []string{"token", "photoToken", "videoToken", "audioToken", "deviceId", "phone"}
+
+const redacted = "[REDACTED]"
+
+// WithRedaction включает или выключает скрытие секретов в логах кадров (по умолчанию включено).
+// Выключать стоит только для локальной отладки протокола
+func WithRedaction(enabled bool) Option {
+	return func(c *ChatClient) {
+		c.redaction = enabled
+	}
+}
+
+// WithRedactFields задает поля, значения которых скрываются в логах кадров,
+// вместо DefaultRedactFields. Имена сравниваются без учета регистра на любой глубине
+func WithRedactFields(fields ...string) Option {
+	return func(c *ChatClient) {
+		c.redactFields = fields
+	}
+}
+
+// redact возвращает JSON кадра для лога со скрытыми значениями чувствительных полей
+func (c *ChatClient) redact(data []byte) string {
+	if !c.redaction {
+		return string(data)
+	}
+	// UseNumber сохраняет большие идентификаторы без потери точности
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var frame interface{}
+	if err := decoder.Decode(&frame); err != nil {
+		return redacted
+	}
+	masked, err := json.Marshal(c.redactValue(frame))
+	if err != nil {
+		return redacted
+	}
+	return string(masked)
+}
+
+func (c *ChatClient) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if c.isSensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = c.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = c.redactValue(item)
+		}
+	}
+	return value
+}
+
+func (c *ChatClient) isSensitive(key string) bool {
+	for _, field := range c.redactFields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package maxclientapi
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger запоминает данные кадров из записей "frame sent"
+type captureLogger struct {
+	mu     sync.Mutex
+	frames []string
+}
+
+func (l *captureLogger) Debug(msg string, args ...any) {
+	if msg != "frame sent" {
+		return
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "data" {
+			l.mu.Lock()
+			l.frames = append(l.frames, fmt.Sprint(args[i+1]))
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *captureLogger) Info(string, ...any)  {}
+func (l *captureLogger) Warn(string, ...any)  {}
+func (l *captureLogger) Error(string, ...any) {}
+
+func (l *captureLogger) all() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.frames, "\n")
+}
+
+// loggedFrames подключает клиент, отправляет сообщение с вложением и возвращает лог кадров
+func loggedFrames(t *testing.T, options ...Option) string {
+	t.Helper()
+	logger := &captureLogger{}
+	server := newTestServer(t)
+	c := server.client(append([]Option{WithDebug(true), WithLogger(logger)}, options...)...)
+	c.Token = "secret-login-token"
+	c.DeviceID = "secret-device-id"
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	err := c.send(64, map[string]interface{}{
+		"chatId": int64(9007199254740993),
+		"message": map[string]interface{}{
+			"attaches": []interface{}{
+				map[string]interface{}{"_type": "VIDEO", "videoId": 1, "token": "secret-attach-token"},
+			},
+		},
+	}, "Video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger.all()
+}
+
+func TestRedactLoggedFrames(t *testing.T) {
+	logged := loggedFrames(t)
+	if !strings.Contains(logged, `"opcode":19`) || !strings.Contains(logged, `"opcode":64`) {
+		t.Fatalf("handshake or message is not logged:\n%s", logged)
+	}
+	for _, secret := range []string{"secret-login-token", "secret-device-id", "secret-attach-token"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("%s is logged:\n%s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, `"token":"`+redacted+`"`) || !strings.Contains(logged, `"deviceId":"`+redacted+`"`) {
+		t.Errorf("secrets are not masked:\n%s", logged)
+	}
+	// Большой идентификатор не должен превратиться в float64
+	if !strings.Contains(logged, `"chatId":9007199254740993`) {
+		t.Errorf("large id lost precision:\n%s", logged)
+	}
+}
+
+func TestRedactionDisabled(t *testing.T) {
+	logged := loggedFrames(t, WithRedaction(false))
+	for _, secret := range []string{"secret-login-token", "secret-device-id", "secret-attach-token", "9007199254740993"} {
+		if !strings.Contains(logged, secret) {
+			t.Errorf("%s is missing from the raw frame:\n%s", secret, logged)
+		}
+	}
+	if strings.Contains(logged, redacted) {
+		t.Errorf("frame is masked with redaction off:\n%s", logged)
+	}
+}
@@ -0,0 +1,200 @@
+package maxclientapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrNotConnected возвращается, если WebSocket соединение не установлено
+var ErrNotConnected = errors.New("maxclientapi: websocket is not connected")
+
+// ErrTimeout возвращается, если сервер не ответил вовремя
+var ErrTimeout = errors.New("maxclientapi: request timed out")
+
+// ServerError описывает ошибку, которую вернул сервер (cmd 3)
+type ServerError struct {
+	Opcode  int
+	Code    string
+	Message string
+	Payload map[string]interface{}
+}
+
+func (e *ServerError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("maxclientapi: opcode %d: %s: %s", e.Opcode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("maxclientapi: opcode %d: %s", e.Opcode, e.Code)
+}
+
+// request отправляет запрос и ждет ответ сервера с тем же seq
+func (c *ChatClient) request(opcode int, payload map[string]interface{}, sendType string) (map[string]interface{}, error) {
+	return c.requestWithin(opcode, payload, sendType, c.requestTimeout)
+}
+
+// requestWithin — request с собственным временем ожидания ответа
+func (c *ChatClient) requestWithin(opcode int, payload map[string]interface{}, sendType string, timeout time.Duration) (map[string]interface{}, error) {
+	reply, err := c.roundTrip(opcode, payload, sendType, timeout)
+	if err != nil {
+		c.opcodeStats.countError(err)
+	}
+	return reply, err
+}
+
+func (c *ChatClient) roundTrip(opcode int, payload map[string]interface{}, sendType string, timeout time.Duration) (map[string]interface{}, error) {
+	reply := make(chan map[string]interface{}, 1)
+	seq := 0
+	out := &outgoing{
+		opcode:   opcode,
+		payload:  payload,
+		sendType: sendType,
+		onSeq: func(s int) {
+			c.pendingMu.Lock()
+			seq = s
+			c.pending[s] = reply
+			c.pendingMu.Unlock()
+		},
+		result: make(chan error, 1),
+	}
+
+	defer func() {
+		c.pendingMu.Lock()
+		if seq != 0 {
+			delete(c.pending, seq)
+		}
+		c.pendingMu.Unlock()
+	}()
+
+	cn, err := c.enqueue(out)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-out.result:
+		if err != nil {
+			return nil, err
+		}
+	case <-cn.done:
+		return nil, ErrNotConnected
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case jsonData := <-reply:
+		replyPayload, _ := jsonData["payload"].(map[string]interface{})
+		if cmd, _ := jsonData["cmd"].(float64); int(cmd) == 3 {
+			return nil, newServerError(opcode, replyPayload)
+		}
+		return replyPayload, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("opcode %d: %w", opcode, ErrTimeout)
+	case <-cn.done:
+		return nil, ErrNotConnected
+	}
+}
+
+// resolvePending передает ответ сервера ожидающему запросу
+func (c *ChatClient) resolvePending(jsonData map[string]interface{}) bool {
+	cmd, _ := jsonData["cmd"].(float64)
+	if int(cmd) == 0 {
+		return false
+	}
+	seq, ok := jsonData["seq"].(float64)
+	if !ok {
+		return false
+	}
+
+	c.pendingMu.Lock()
+	reply, ok := c.pending[int(seq)]
+	c.pendingMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	select {
+	case reply <- jsonData:
+	default:
+	}
+	return true
+}
+
+func newServerError(opcode int, payload map[string]interface{}) *ServerError {
+	code, _ := payload["error"].(string)
+	message, _ := payload["localizedMessage"].(string)
+	if message == "" {
+		message, _ = payload["message"].(string)
+	}
+	return &ServerError{Opcode: opcode, Code: code, Message: message, Payload: payload}
+}
+
+// expectAttach регистрирует ожидание уведомления об обработке вложения (opcode 136).
+// Регистрировать нужно до загрузки, иначе уведомление может прийти раньше.
+func (c *ChatClient) expectAttach(key string) chan map[string]interface{} {
+	done := make(chan map[string]interface{}, 1)
+	c.pendingMu.Lock()
+	c.attachWaiters[key] = done
+	c.pendingMu.Unlock()
+	return done
+}
+
+// waitAttach ждет уведомления, зарегистрированного через expectAttach
+func (c *ChatClient) waitAttach(key string, done chan map[string]interface{}) error {
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.attachWaiters, key)
+		c.pendingMu.Unlock()
+	}()
+
+	timer := time.NewTimer(c.processingTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("waiting for %s processing: %w", key, ErrTimeout)
+	case <-c.stopped():
+		return ErrNotConnected
+	}
+}
+
+// handleOpcode136 обрабатывает уведомления о завершении обработки вложения
+func (c *ChatClient) handleOpcode136(jsonData map[string]interface{}) {
+	payload, _ := jsonData["payload"].(map[string]interface{})
+
+	var keys []string
+	if videoID, ok := payload["videoId"]; ok {
+		keys = append(keys, "video:"+idString(videoID))
+	}
+	if fileID, ok := payload["fileId"]; ok {
+		keys = append(keys, "file:"+idString(fileID))
+	}
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	for _, key := range keys {
+		if done, ok := c.attachWaiters[key]; ok {
+			select {
+			case done <- payload:
+			default:
+			}
+		}
+	}
+}
+
+// idString приводит идентификатор из JSON к строке без экспоненты
+func idString(id interface{}) string {
+	switch v := id.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,179 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Виды вложений, которые выбирает UploadReader
+const (
+	KindPhoto = "PHOTO"
+	KindVideo = "VIDEO"
+	KindAudio = "AUDIO"
+	KindFile  = "FILE"
+)
+
+// sniffLen — сколько байт нужно http.DetectContentType
+const sniffLen = 512
+
+// DetectKind определяет вид вложения по MIME типу
+func DetectKind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	switch {
+	case mediaType == "image/jpeg", mediaType == "image/png", mediaType == "image/gif", mediaType == "image/webp":
+		return KindPhoto
+	case strings.HasPrefix(mediaType, "video/"):
+		return KindVideo
+	case mediaType == "audio/ogg", mediaType == "audio/opus", mediaType == "application/ogg":
+		// http.DetectContentType определяет любой Ogg поток как application/ogg
+		return KindAudio
+	default:
+		return KindFile
+	}
+}
+
+// UploadReader определяет тип содержимого r и отправляет его как фото, видео,
+// голосовое сообщение или файл. Голосовым становится только Ogg/Opus, остальное
+// аудио отправляется файлом. Возвращает выбранный вид вложения
+func (c *ChatClient) UploadReader(chatID interface{}, r io.Reader, caption string, options ...SendOption) (string, error) {
+	return c.uploadReader(chatID, r, "", caption, options)
+}
+
+// UploadFromURL скачивает файл по ссылке и пересылает его в чат без сохранения на диск.
+// Имя файла берется из Content-Disposition или пути ссылки, если не задано WithFileName
+func (c *ChatClient) UploadFromURL(chatID interface{}, url, caption string, options ...SendOption) (string, error) {
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch %s: status %d", url, resp.StatusCode)
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	if name == "/" || name == "." {
+		name = ""
+	}
+
+	var body io.Reader = resp.Body
+	if resp.ContentLength > 0 {
+		body = &sizedReader{r: resp.Body, n: resp.ContentLength}
+	}
+
+	// Имя из ссылки подставляется первым, чтобы WithFileName могла его переопределить
+	options = append([]SendOption{WithFileName(name)}, options...)
+	return c.uploadReader(chatID, body, resp.Header.Get("Content-Type"), caption, options)
+}
+
+// uploadReader выбирает способ отправки по содержимому и отправляет r
+func (c *ChatClient) uploadReader(chatID interface{}, r io.Reader, headerType, caption string, options []SendOption) (string, error) {
+	kind, contentType, body, err := sniffReader(r, headerType)
+	if err != nil {
+		return kind, err
+	}
+
+	o := newSendOptions(defaultFileName(contentType), options)
+	if o.name == "" {
+		o.name = defaultFileName(contentType)
+	}
+	return kind, c.uploadAndSend(chatID, caption, kind, body, o)
+}
+
+// sniffReader определяет вид вложения по первым байтам r и возвращает поток с теми же данными.
+// headerType используется, если по содержимому тип определить не удалось
+func sniffReader(r io.Reader, headerType string) (kind, contentType string, body io.Reader, err error) {
+	size := readerSize(r)
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", nil, err
+	}
+	head = head[:n]
+
+	contentType = http.DetectContentType(head)
+	if contentType == "application/octet-stream" && headerType != "" {
+		contentType = headerType
+	}
+	kind = DetectKind(contentType)
+
+	body = io.MultiReader(bytes.NewReader(head), r)
+	if size >= 0 {
+		body = &sizedReader{r: body, n: size}
+	}
+
+	if kind == KindAudio {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return kind, contentType, nil, err
+		}
+		// Ogg с Vorbis или другим кодеком голосовым сообщением не отправить
+		if _, err := oggOpusDuration(data); err != nil {
+			kind = KindFile
+		}
+		body = bytes.NewReader(data)
+	}
+	return kind, contentType, body, nil
+}
+
+// fileExtensions — привычные расширения для типов, которые определяет http.DetectContentType.
+// mime.ExtensionsByType не подходит: он возвращает отсортированный список (.jfif для JPEG)
+var fileExtensions = map[string]string{
+	"image/jpeg":               ".jpg",
+	"image/png":                ".png",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/bmp":                ".bmp",
+	"video/mp4":                ".mp4",
+	"video/webm":               ".webm",
+	"video/avi":                ".avi",
+	"audio/ogg":                ".ogg",
+	"audio/opus":               ".ogg",
+	"application/ogg":          ".ogg",
+	"audio/mpeg":               ".mp3",
+	"audio/wave":               ".wav",
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"application/x-gzip":       ".gz",
+	"text/plain":               ".txt",
+	"text/html":                ".html",
+	"application/json":         ".json",
+	"application/octet-stream": ".bin",
+}
+
+// defaultFileName подбирает имя файла по MIME типу
+func defaultFileName(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "file"
+	}
+	return "file" + fileExtensions[mediaType]
+}
+
+// sizedReader сохраняет известный размер данных для отчета о прогрессе
+type sizedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (s *sizedReader) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	s.n -= int64(n)
+	return n, err
+}
+
+func (s *sizedReader) Len() int {
+	return int(s.n)
+}
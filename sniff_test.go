@@ -0,0 +1,127 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// oggPage собирает страницу Ogg с одним пакетом body
+func oggPage(serial uint32, granule int64, body []byte) []byte {
+	var page bytes.Buffer
+	page.WriteString("OggS")
+	page.Write([]byte{0, 0})
+	binary.Write(&page, binary.LittleEndian, granule)
+	binary.Write(&page, binary.LittleEndian, serial)
+	page.Write(make([]byte, 8)) // номер страницы и CRC
+	var lacing []byte
+	for n := len(body); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+	page.WriteByte(byte(len(lacing)))
+	page.Write(lacing)
+	page.Write(body)
+	return page.Bytes()
+}
+
+// opusStream — Ogg/Opus поток длительностью seconds секунд с pre-skip 312
+func opusStream(seconds int64) []byte {
+	// версия 1, 1 канал, pre-skip 312, 48 кГц
+	head := []byte("OpusHead\x01\x01\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	stream := oggPage(1, 0, head)
+	stream = append(stream, oggPage(1, 0, []byte("OpusTags"))...)
+	stream = append(stream, oggPage(1, seconds*opusSampleRate+312, make([]byte, 300))...)
+	return stream
+}
+
+func TestDetectKind(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"image/jpeg", KindPhoto},
+		{"image/png", KindPhoto},
+		{"image/webp", KindPhoto},
+		{"video/mp4", KindVideo},
+		{"video/webm; codecs=vp9", KindVideo},
+		{"audio/ogg", KindAudio},
+		{"audio/opus", KindAudio},
+		{"application/ogg", KindAudio},
+		{"audio/mpeg", KindFile},
+		{"image/svg+xml", KindFile},
+		{"application/pdf", KindFile},
+		{"text/plain; charset=utf-8", KindFile},
+		{"", KindFile},
+	}
+	for _, tt := range tests {
+		if got := DetectKind(tt.contentType); got != tt.want {
+			t.Errorf("DetectKind(%q) = %s, want %s", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestSniffReaderKind(t *testing.T) {
+	vorbis := oggPage(1, 0, []byte("\x01vorbis\x00\x00\x00\x00\x02\x44\xac\x00\x00"))
+
+	tests := []struct {
+		name       string
+		data       []byte
+		headerType string
+		want       string
+	}{
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "", KindPhoto},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "", KindPhoto},
+		{"mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), "", KindVideo},
+		{"opus", opusStream(3), "", KindAudio},
+		{"vorbis", vorbis, "", KindFile},
+		{"text", []byte("hello, world"), "", KindFile},
+		{"unknown bytes with header", []byte{0x00, 0x01, 0x02, 0x03}, "video/mp4", KindVideo},
+		{"known bytes ignore header", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "video/mp4", KindPhoto},
+		{"empty", nil, "", KindFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, _, body, err := sniffReader(bytes.NewReader(tt.data), tt.headerType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind != tt.want {
+				t.Errorf("kind = %s, want %s", kind, tt.want)
+			}
+			// Прочитанное для определения типа должно вернуться в поток
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("body differs from input: %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestDefaultFileName(t *testing.T) {
+	tests := map[string]string{
+		"image/jpeg":                "file.jpg",
+		"image/png":                 "file.png",
+		"video/mp4":                 "file.mp4",
+		"application/ogg":           "file.ogg",
+		"audio/ogg; codecs=opus":    "file.ogg",
+		"application/pdf":           "file.pdf",
+		"text/plain; charset=utf-8": "file.txt",
+		"application/octet-stream":  "file.bin",
+		"application/x-unknown":     "file",
+		"":                          "file",
+		"not a type;;":              "file",
+	}
+	for contentType, want := range tests {
+		if got := defaultFileName(contentType); got != want {
+			t.Errorf("defaultFileName(%q) = %q, want %q", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrFileTooLarge возвращается, если сервер отклонил файл из-за превышения размера
+var ErrFileTooLarge = errors.New("maxclientapi: file exceeds server size limit")
+
+// ErrPartMismatch возвращается ReassembleParts, если часть повреждена или не совпадает с манифестом
+var ErrPartMismatch = errors.New("maxclientapi: file part does not match manifest")
+
+// ManifestSuffix добавляется к имени файла для манифеста частей
+const ManifestSuffix = ".manifest.json"
+
+// PartsManifest описывает файл, отправленный частями
+type PartsManifest struct {
+	Name   string     `json:"name"`
+	Size   int64      `json:"size"`
+	SHA256 string     `json:"sha256"`
+	Parts  []FilePart `json:"parts"`
+}
+
+// FilePart описывает одну часть файла
+type FilePart struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// sendFileSplit отправляет файл целиком, а если сервер отклонил его из-за размера (ErrFileTooLarge),
+// делит на части name.001, name.002, ... не больше partSize и отправляет одним сообщением с манифестом
+func (c *ChatClient) sendFileSplit(chatID interface{}, caption string, r io.Reader, o *sendOptions) error {
+	src, size, cleanup, err := seekableSource(r)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	fileID, _, err := c.uploadFile(&sizedReader{r: io.NewSectionReader(src, 0, size), n: size}, o)
+	if err == nil {
+		attach := map[string]interface{}{
+			"_type":  "FILE",
+			"fileId": fileID,
+		}
+		return c.sendAttaches(chatID, caption, []interface{}{attach}, "File")
+	}
+	if !errors.Is(err, ErrFileTooLarge) {
+		return err
+	}
+	if size <= o.splitSize {
+		return fmt.Errorf("%w: part size %d is above the server limit", err, o.splitSize)
+	}
+	return c.sendParts(chatID, caption, src, size, o)
+}
+
+// sendParts загружает файл частями, считая SHA-256 по ходу загрузки, и последним — манифест
+func (c *ChatClient) sendParts(chatID interface{}, caption string, src io.ReaderAt, size int64, o *sendOptions) error {
+	count := int((size + o.splitSize - 1) / o.splitSize)
+
+	// Один запрос на все части и манифест
+	slots, err := c.requestFileSlots(count + 1)
+	if err != nil {
+		return err
+	}
+
+	manifest := PartsManifest{Name: o.name, Size: size}
+	total := sha256.New()
+	attaches := make([]interface{}, 0, len(slots))
+	for i := 0; i < count; i++ {
+		offset := int64(i) * o.splitSize
+		part := FilePart{Name: fmt.Sprintf("%s.%03d", o.name, i+1), Size: o.splitSize}
+		if offset+part.Size > size {
+			part.Size = size - offset
+		}
+
+		partSum := sha256.New()
+		body := io.TeeReader(io.NewSectionReader(src, offset, part.Size), io.MultiWriter(partSum, total))
+		if err := c.uploadToSlot(slots[i], part.Name, &sizedReader{r: body, n: part.Size}, o.progress); err != nil {
+			return fmt.Errorf("part %s: %w", part.Name, err)
+		}
+		part.SHA256 = hex.EncodeToString(partSum.Sum(nil))
+		manifest.Parts = append(manifest.Parts, part)
+		attaches = append(attaches, map[string]interface{}{"_type": "FILE", "fileId": slots[i].fileID})
+	}
+	manifest.SHA256 = hex.EncodeToString(total.Sum(nil))
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestSlot := slots[count]
+	if err := c.uploadToSlot(manifestSlot, o.name+ManifestSuffix, bytes.NewReader(manifestData), nil); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	attaches = append(attaches, map[string]interface{}{"_type": "FILE", "fileId": manifestSlot.fileID})
+
+	return c.sendAttaches(chatID, caption, attaches, "File parts")
+}
+
+// seekableSource дает произвольный доступ к данным r, чтобы после отказа сервера
+// их можно было загрузить заново частями. Файлы и bytes.Reader читаются с текущей позиции,
+// остальные потоки копируются во временный файл, который удаляет cleanup
+func seekableSource(r io.Reader) (src io.ReaderAt, size int64, cleanup func(), err error) {
+	if rs, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		offset, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			end, err := rs.Seek(0, io.SeekEnd)
+			if err == nil {
+				return io.NewSectionReader(rs, offset, end-offset), end - offset, func() {}, nil
+			}
+		}
+	}
+
+	file, err := os.CreateTemp("", "maxclientapi-split-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup = func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	size, err = io.Copy(file, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return file, size, cleanup, nil
+}
+
+// ReassembleParts собирает файл из частей, лежащих рядом с манифестом,
+// и проверяет размер и SHA-256 каждой части и всего файла
+func ReassembleParts(manifestPath, outPath string) error {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	var manifest PartsManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	total := sha256.New()
+	dir := filepath.Dir(manifestPath)
+	for _, part := range manifest.Parts {
+		if err := appendPart(out, total, filepath.Join(dir, filepath.Base(part.Name)), part); err != nil {
+			return err
+		}
+	}
+
+	if hex.EncodeToString(total.Sum(nil)) != manifest.SHA256 {
+		return fmt.Errorf("%w: %s checksum", ErrPartMismatch, manifest.Name)
+	}
+	return out.Close()
+}
+
+func appendPart(out io.Writer, total io.Writer, path string, part FilePart) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	partSum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, total, partSum), file)
+	if err != nil {
+		return err
+	}
+	if n != part.Size || hex.EncodeToString(partSum.Sum(nil)) != part.SHA256 {
+		return fmt.Errorf("%w: %s", ErrPartMismatch, part.Name)
+	}
+	return nil
+}
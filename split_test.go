@@ -0,0 +1,184 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// uploadServer принимает файлы не больше limit байт и сообщает об их обработке через opcode 136
+type uploadServer struct {
+	ws    *testServer
+	http  *httptest.Server
+	limit int
+
+	mu       sync.Mutex
+	nextID   int
+	files    map[string][]byte
+	rejected int
+	attaches []interface{}
+}
+
+func newUploadServer(t *testing.T, limit int) *uploadServer {
+	t.Helper()
+	s := &uploadServer{ws: newTestServer(t), limit: limit, files: map[string][]byte{}}
+	s.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		if len(data) > s.limit {
+			s.rejected++
+			s.mu.Unlock()
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.files[header.Filename] = data
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+		id := r.URL.Query().Get("id")
+		s.ws.push(map[string]interface{}{"ver": 11, "cmd": 0, "seq": 0, "opcode": 136, "payload": map[string]interface{}{"fileId": id}})
+	}))
+	t.Cleanup(s.http.Close)
+
+	s.ws.reply = func(frame map[string]interface{}) map[string]interface{} {
+		payload, _ := frame["payload"].(map[string]interface{})
+		frame["cmd"] = 1
+		switch frame["opcode"].(float64) {
+		case 87:
+			var info []interface{}
+			s.mu.Lock()
+			for i := 0; i < int(payload["count"].(float64)); i++ {
+				s.nextID++
+				info = append(info, map[string]interface{}{
+					"url":    fmt.Sprintf("%s/?id=%d", s.http.URL, s.nextID),
+					"fileId": fmt.Sprint(s.nextID),
+				})
+			}
+			s.mu.Unlock()
+			frame["payload"] = map[string]interface{}{"info": info}
+		case 64:
+			message, _ := payload["message"].(map[string]interface{})
+			s.mu.Lock()
+			s.attaches, _ = message["attaches"].([]interface{})
+			s.mu.Unlock()
+			frame["payload"] = map[string]interface{}{}
+		default:
+			frame["payload"] = map[string]interface{}{}
+		}
+		return frame
+	}
+	return s
+}
+
+func (s *uploadServer) client(t *testing.T) *ChatClient {
+	t.Helper()
+	c := s.ws.client()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.Close(ctx)
+	})
+	return c
+}
+
+// onlyReader скрывает от отправки все методы, кроме Read
+type onlyReader struct{ io.Reader }
+
+func TestSplitOnlyAfterRejection(t *testing.T) {
+	server := newUploadServer(t, 1000)
+	c := server.client(t)
+
+	// Файл больше части, но в пределах лимита сервера, уходит целиком
+	data := bytes.Repeat([]byte("a"), 900)
+	if err := c.SendDocument(1, bytes.NewReader(data), "", WithFileName("small.bin"), WithSplitParts(300)); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.attaches) != 1 || server.rejected != 0 {
+		t.Fatalf("attaches = %d, rejected = %d: file was split without a rejection", len(server.attaches), server.rejected)
+	}
+	if !bytes.Equal(server.files["small.bin"], data) {
+		t.Fatal("uploaded file differs")
+	}
+}
+
+func TestSplitAfterRejection(t *testing.T) {
+	server := newUploadServer(t, 1000)
+	c := server.client(t)
+
+	data := make([]byte, 2500)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// Поток без произвольного доступа проходит через временный файл
+	if err := c.SendDocument(1, onlyReader{bytes.NewReader(data)}, "", WithFileName("big.bin"), WithSplitParts(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if server.rejected != 1 {
+		t.Fatalf("rejected = %d, want 1", server.rejected)
+	}
+	// Три части и манифест
+	if len(server.attaches) != 4 {
+		t.Fatalf("attaches = %d, want 4", len(server.attaches))
+	}
+
+	dir := t.TempDir()
+	for name, body := range server.files {
+		if err := os.WriteFile(filepath.Join(dir, name), body, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "out.bin")
+	if err := ReassembleParts(filepath.Join(dir, "big.bin"+ManifestSuffix), out); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("reassembled file differs")
+	}
+
+	// Испорченная часть обнаруживается по контрольной сумме
+	if err := os.WriteFile(filepath.Join(dir, "big.bin.002"), make([]byte, 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReassembleParts(filepath.Join(dir, "big.bin"+ManifestSuffix), out); !errors.Is(err, ErrPartMismatch) {
+		t.Fatalf("ReassembleParts with a corrupted part: %v", err)
+	}
+}
+
+func TestSplitPartAboveLimit(t *testing.T) {
+	server := newUploadServer(t, 100)
+	c := server.client(t)
+
+	err := c.SendDocument(1, bytes.NewReader(make([]byte, 200)), "", WithFileName("doc.bin"), WithSplitParts(500))
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("err = %v, want ErrFileTooLarge", err)
+	}
+	if len(server.attaches) != 0 {
+		t.Fatal("message sent after a rejected upload")
+	}
+}
@@ -0,0 +1,113 @@
+package maxclientapi
+
+// State — состояние соединения клиента
+type State int
+
+const (
+	// StateConnecting — устанавливается WebSocket соединение
+	StateConnecting State = iota
+	// StateHandshaking — соединение установлено, ожидается ответ на handshake
+	StateHandshaking
+	// StateReady — сессия авторизована, можно отправлять запросы
+	StateReady
+	// StateReconnecting — соединение потеряно, клиент переподключается
+	StateReconnecting
+	// StateClosed — клиент не подключен или остановлен
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateHandshaking:
+		return "handshaking"
+	case StateReady:
+		return "ready"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// State возвращает текущее состояние соединения
+func (c *ChatClient) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// OnStateChange добавляет обработчик смены состояния. Обработчики вызываются
+// из внутренних горутин клиента строго по одному и в порядке переходов,
+// поэтому не должны блокироваться надолго
+func (c *ChatClient) OnStateChange(handler func(from, to State)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stateHandlers = append(c.stateHandlers, handler)
+}
+
+// Ready возвращает канал, который закрывается, когда сервер ответил на handshake.
+// После разрыва соединения возвращается новый канал, закрывающийся при следующей авторизации
+func (c *ChatClient) Ready() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ready
+}
+
+// setState переводит клиент в состояние to и вызывает обработчики
+func (c *ChatClient) setState(to State) {
+	c.changeState(to, nil)
+}
+
+// changeState переводит клиент в состояние to, если allow разрешает переход
+// из текущего состояния (nil — из любого), и сообщает, произошел ли переход
+func (c *ChatClient) changeState(to State, allow func(from State) bool) bool {
+	c.mu.Lock()
+	from := c.state
+	if from == to || (allow != nil && !allow(from)) {
+		c.mu.Unlock()
+		return false
+	}
+	c.state = to
+	if to == StateReady {
+		close(c.ready)
+	} else if from == StateReady {
+		c.ready = make(chan struct{})
+	}
+	c.transitions = append(c.transitions, [2]State{from, to})
+	if c.notifying {
+		// Переход доставит горутина, которая уже вызывает обработчики
+		c.mu.Unlock()
+		return true
+	}
+	c.notifying = true
+	c.mu.Unlock()
+
+	c.notifyState()
+	return true
+}
+
+// notifyState вызывает обработчики для накопленных переходов по порядку
+func (c *ChatClient) notifyState() {
+	for {
+		c.mu.Lock()
+		if len(c.transitions) == 0 {
+			c.notifying = false
+			c.mu.Unlock()
+			return
+		}
+		transition := c.transitions[0]
+		c.transitions = c.transitions[1:]
+		handlers := c.stateHandlers
+		c.mu.Unlock()
+
+		from, to := transition[0], transition[1]
+		c.logger.Info("state changed", "from", from, "to", to)
+		for _, handler := range handlers {
+			handler(from, to)
+		}
+	}
+}
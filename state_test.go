@@ -0,0 +1,174 @@
+package maxclientapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandshakeRejected(t *testing.T) {
+	server := newTestServer(t)
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		frame["cmd"] = 1
+		if frame["opcode"].(float64) == 19 {
+			frame["cmd"] = 3
+			frame["payload"] = map[string]interface{}{"error": "login.token", "message": "FAIL_LOGIN_TOKEN"}
+		}
+		return frame
+	}
+	c := server.client(WithAllowReconnect(true))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	select {
+	case err := <-done:
+		var serverErr *ServerError
+		if !errors.As(err, &serverErr) || serverErr.Code != "login.token" {
+			t.Fatalf("Wait() = %v, want handshake ServerError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Wait did not return, state %s", c.State())
+	}
+	if c.State() != StateClosed {
+		t.Fatalf("state %s, want closed", c.State())
+	}
+	select {
+	case <-c.Ready():
+		t.Fatal("Ready closed after rejected handshake")
+	default:
+	}
+	// Отклоненный токен не должен приводить к переподключениям
+	time.Sleep(50 * time.Millisecond)
+	if n := server.connections(); n != 1 {
+		t.Fatalf("connections = %d, want 1", n)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	server := newTestServer(t)
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		if frame["opcode"].(float64) == 19 {
+			return nil
+		}
+		frame["cmd"] = 1
+		return frame
+	}
+	c := server.client(WithRequestTimeout(50 * time.Millisecond))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Wait() = %v, want ErrTimeout", err)
+	}
+}
+
+func TestStateTransitionsInOrder(t *testing.T) {
+	server := newTestServer(t)
+	c := server.client(WithAllowReconnect(true))
+
+	var mu sync.Mutex
+	var transitions [][2]State
+	c.OnStateChange(func(from, to State) {
+		mu.Lock()
+		transitions = append(transitions, [2]State{from, to})
+		mu.Unlock()
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		waitReady(t, c)
+		server.dropAll()
+		time.Sleep(5 * time.Millisecond)
+		c.Stop()
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	prev := StateClosed
+	for i, tr := range transitions {
+		if tr[0] != prev {
+			t.Fatalf("transition %d: %s -> %s after %s", i, tr[0], tr[1], prev)
+		}
+		prev = tr[1]
+	}
+	if prev != StateClosed {
+		t.Fatalf("last state %s, want closed", prev)
+	}
+}
+
+func TestSubscribeOnlyAfterHandshake(t *testing.T) {
+	for _, accept := range []bool{false, true} {
+		server := newTestServer(t)
+		var mu sync.Mutex
+		var opcodes []float64
+		subscribed := make(chan struct{}, 1)
+		server.reply = func(frame map[string]interface{}) map[string]interface{} {
+			opcode := frame["opcode"].(float64)
+			mu.Lock()
+			opcodes = append(opcodes, opcode)
+			mu.Unlock()
+			frame["cmd"] = 1
+			frame["payload"] = map[string]interface{}{}
+			switch {
+			case opcode == 19 && !accept:
+				frame["cmd"] = 3
+				frame["payload"] = map[string]interface{}{"error": "login.token"}
+			case opcode == 75:
+				subscribed <- struct{}{}
+			}
+			return frame
+		}
+		c := server.client()
+		c.WatchChats = []string{"1"}
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+
+		if accept {
+			select {
+			case <-subscribed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("watch chats are not subscribed after handshake")
+			}
+			c.Stop()
+		} else {
+			c.Wait()
+			// Подписка могла бы уйти сразу после ответа на handshake
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		mu.Lock()
+		handshake, subscribe := -1, -1
+		for i, opcode := range opcodes {
+			switch opcode {
+			case 19:
+				handshake = i
+			case 75:
+				subscribe = i
+			}
+		}
+		mu.Unlock()
+		if !accept && subscribe >= 0 {
+			t.Fatal("subscribed after a rejected handshake")
+		}
+		if accept && subscribe < handshake {
+			t.Fatalf("subscribe at %d, handshake at %d", subscribe, handshake)
+		}
+	}
+}
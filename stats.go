@@ -0,0 +1,177 @@
+package maxclientapi
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rttWindowSize — сколько последних замеров RTT учитывается в Stats
+const rttWindowSize = 256
+
+// Stats — сводка о качестве соединения
+type Stats struct {
+	// RTTP50 и RTTP99 — медиана и 99-й перцентиль времени ответа на keepalive
+	// по последним замерам (0, пока замеров нет)
+	RTTP50     time.Duration
+	RTTP99     time.Duration
+	RTTSamples int
+
+	FramesIn  uint64
+	FramesOut uint64
+	BytesIn   uint64
+	BytesOut  uint64
+	// FramesInByOpcode и FramesOutByOpcode — число кадров протокола по opcode
+	FramesInByOpcode  map[int]uint64
+	FramesOutByOpcode map[int]uint64
+	// SendErrors — ошибки отправки и запросов: код ошибки сервера,
+	// "timeout", "not_connected" или "write"
+	SendErrors map[string]uint64
+
+	// UploadedBytes и DownloadedBytes — байты, переданные при загрузке и скачивании файлов
+	UploadedBytes   uint64
+	DownloadedBytes uint64
+
+	Reconnects    uint64
+	DroppedEvents uint64
+	QueueDepth    int
+	// HandshakeLatency — время ответа на последний handshake
+	HandshakeLatency time.Duration
+	// Uptime — время с установки текущего соединения (0, если клиент не подключен)
+	Uptime time.Duration
+}
+
+// Stats возвращает статистику соединения. RTT измеряется по ответам на keepalive,
+// поэтому для него нужен StartKeepalive
+func (c *ChatClient) Stats() Stats {
+	stats := Stats{
+		FramesIn:         atomic.LoadUint64(&c.framesIn),
+		FramesOut:        atomic.LoadUint64(&c.framesOut),
+		BytesIn:          atomic.LoadUint64(&c.bytesIn),
+		BytesOut:         atomic.LoadUint64(&c.bytesOut),
+		UploadedBytes:    atomic.LoadUint64(&c.uploaded),
+		DownloadedBytes:  atomic.LoadUint64(&c.downloaded),
+		Reconnects:       atomic.LoadUint64(&c.reconnects),
+		DroppedEvents:    c.DroppedEvents(),
+		QueueDepth:       c.QueueDepth(),
+		HandshakeLatency: time.Duration(atomic.LoadInt64(&c.handshake)),
+	}
+	stats.RTTP50, stats.RTTP99, stats.RTTSamples = c.rtt.percentiles()
+	stats.FramesInByOpcode, stats.FramesOutByOpcode, stats.SendErrors = c.opcodeStats.snapshot()
+
+	c.mu.Lock()
+	if c.conn != nil {
+		stats.Uptime = time.Since(c.connectedAt)
+	}
+	c.mu.Unlock()
+	return stats
+}
+
+// rttWindow хранит последние rttWindowSize замеров RTT
+type rttWindow struct {
+	mu      sync.Mutex
+	samples [rttWindowSize]time.Duration
+	next    int
+	count   int
+}
+
+func (w *rttWindow) add(rtt time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = rtt
+	w.next = (w.next + 1) % rttWindowSize
+	if w.count < rttWindowSize {
+		w.count++
+	}
+}
+
+func (w *rttWindow) percentiles() (p50, p99 time.Duration, count int) {
+	w.mu.Lock()
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	w.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 50), percentile(sorted, 99), len(sorted)
+}
+
+// percentile возвращает p-й перцентиль отсортированных значений (nearest-rank)
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// opcodeStats считает кадры по opcode и ошибки отправки по коду
+type opcodeStats struct {
+	mu     sync.Mutex
+	in     map[int]uint64
+	out    map[int]uint64
+	errors map[string]uint64
+}
+
+func (s *opcodeStats) countIn(opcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.in == nil {
+		s.in = make(map[int]uint64)
+	}
+	s.in[opcode]++
+}
+
+func (s *opcodeStats) countOut(opcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		s.out = make(map[int]uint64)
+	}
+	s.out[opcode]++
+}
+
+func (s *opcodeStats) countError(err error) {
+	code := "write"
+	var serverErr *ServerError
+	switch {
+	case errors.As(err, &serverErr):
+		code = serverErr.Code
+		if code == "" {
+			code = "unknown"
+		}
+	case errors.Is(err, ErrTimeout):
+		code = "timeout"
+	case errors.Is(err, ErrNotConnected):
+		code = "not_connected"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errors == nil {
+		s.errors = make(map[string]uint64)
+	}
+	s.errors[code]++
+}
+
+func (s *opcodeStats) snapshot() (in, out map[int]uint64, errs map[string]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in = make(map[int]uint64, len(s.in))
+	for opcode, n := range s.in {
+		in[opcode] = n
+	}
+	out = make(map[int]uint64, len(s.out))
+	for opcode, n := range s.out {
+		out[opcode] = n
+	}
+	errs = make(map[string]uint64, len(s.errors))
+	for code, n := range s.errors {
+		errs[code] = n
+	}
+	return in, out, errs
+}
@@ -0,0 +1,412 @@
+package maxclientapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SendOption определяет опции отправки вложений
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	name      string
+	duration  time.Duration
+	width     int
+	height    int
+	progress  ProgressFunc
+	splitSize int64
+
+	stripMetadata   bool
+	keepOrientation bool
+}
+
+// WithFileName задает имя файла при загрузке
+func WithFileName(name string) SendOption {
+	return func(o *sendOptions) {
+		o.name = name
+	}
+}
+
+// WithDuration задает длительность видео или аудио
+func WithDuration(duration time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.duration = duration
+	}
+}
+
+// WithDimensions задает ширину и высоту видео
+func WithDimensions(width, height int) SendOption {
+	return func(o *sendOptions) {
+		o.width = width
+		o.height = height
+	}
+}
+
+// WithProgress задает функцию, получающую прогресс загрузки.
+// Для канала используйте WithProgress(ProgressChan(ch))
+func WithProgress(fn ProgressFunc) SendOption {
+	return func(o *sendOptions) {
+		o.progress = fn
+	}
+}
+
+// WithStripMetadata удаляет EXIF (включая GPS), XMP и текстовые метаданные из JPEG
+// и PNG перед загрузкой фото. При keepOrientation сохраняется только тег ориентации
+func WithStripMetadata(keepOrientation bool) SendOption {
+	return func(o *sendOptions) {
+		o.stripMetadata = true
+		o.keepOrientation = keepOrientation
+	}
+}
+
+// WithSplitParts разрешает отправлять файлы, превышающие лимит сервера, частями
+// не больше partSize байт. Части отправляются одним сообщением вместе с манифестом
+// для сборки (см. ReassembleParts)
+func WithSplitParts(partSize int64) SendOption {
+	return func(o *sendOptions) {
+		o.splitSize = partSize
+	}
+}
+
+func newSendOptions(defaultName string, options []SendOption) *sendOptions {
+	o := &sendOptions{name: defaultName}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// SendVideo загружает видео, ждет его обработки на сервере и отправляет в чат
+func (c *ChatClient) SendVideo(chatID interface{}, r io.Reader, caption string, options ...SendOption) error {
+	return c.uploadAndSend(chatID, caption, KindVideo, r, newSendOptions("video.mp4", options))
+}
+
+// SendPhoto загружает фото и отправляет его в чат
+func (c *ChatClient) SendPhoto(chatID interface{}, r io.Reader, caption string, options ...SendOption) error {
+	return c.uploadAndSend(chatID, caption, KindPhoto, r, newSendOptions("photo.jpg", options))
+}
+
+// SendDocument загружает произвольный файл и отправляет его в чат как FILE
+func (c *ChatClient) SendDocument(chatID interface{}, r io.Reader, caption string, options ...SendOption) error {
+	return c.uploadAndSend(chatID, caption, KindFile, r, newSendOptions("file", options))
+}
+
+// SendVoice загружает Ogg/Opus запись и отправляет ее как голосовое сообщение.
+// Если длительность не задана через WithDuration, она определяется из контейнера.
+func (c *ChatClient) SendVoice(chatID interface{}, r io.Reader, options ...SendOption) error {
+	return c.uploadAndSend(chatID, "", KindAudio, r, newSendOptions("voice.ogg", options))
+}
+
+// uploadAndSend загружает вложение нужного вида и отправляет его в чат.
+// Если задан кэш загрузок, повторная отправка того же содержимого не требует загрузки
+func (c *ChatClient) uploadAndSend(chatID interface{}, caption, kind string, r io.Reader, o *sendOptions) error {
+	if kind == KindFile && o.splitSize > 0 {
+		return c.sendFileSplit(chatID, caption, r, o)
+	}
+
+	sendType := map[string]string{
+		KindPhoto: "Photo",
+		KindVideo: "Video",
+		KindAudio: "Voice",
+		KindFile:  "File",
+	}[kind]
+
+	if c.uploadCache == nil {
+		attach, err := c.upload(kind, r, o)
+		if err != nil {
+			return err
+		}
+		return c.sendAttaches(chatID, caption, []interface{}{attach}, sendType)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	key := uploadCacheKey(kind, data, o)
+
+	if attach, ok := c.uploadCache.Get(key); ok {
+		err := c.sendAttaches(chatID, caption, []interface{}{attach}, sendType)
+		var serverErr *ServerError
+		if !errors.As(err, &serverErr) {
+			return err
+		}
+		// Сервер больше не принимает сохраненный токен: загружаем заново
+		c.logger.Debug("cached upload rejected", "type", sendType, "chat_id", chatID, "err", err)
+		c.uploadCache.Delete(key)
+	}
+
+	attach, err := c.upload(kind, bytes.NewReader(data), o)
+	if err != nil {
+		return err
+	}
+	if err := c.uploadCache.Put(key, attach); err != nil {
+		c.logger.Warn("upload cache failed", "err", err)
+	}
+	return c.sendAttaches(chatID, caption, []interface{}{attach}, sendType)
+}
+
+// upload загружает содержимое как вложение указанного вида и возвращает его для отправки
+func (c *ChatClient) upload(kind string, r io.Reader, o *sendOptions) (map[string]interface{}, error) {
+	switch kind {
+	case KindPhoto:
+		return c.uploadPhoto(r, o)
+	case KindVideo:
+		return c.uploadVideo(r, o)
+	case KindAudio:
+		return c.uploadVoice(r, o)
+	default:
+		fileID, _, err := c.uploadFile(r, o)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"_type":  "FILE",
+			"fileId": fileID,
+		}, nil
+	}
+}
+
+// uploadVideo загружает видео (opcode 82) и ждет завершения его обработки
+func (c *ChatClient) uploadVideo(r io.Reader, o *sendOptions) (map[string]interface{}, error) {
+	reply, err := c.request(82, map[string]interface{}{"count": 1}, "Request URL to send video")
+	if err != nil {
+		return nil, fmt.Errorf("request video upload url: %w", err)
+	}
+	info, _ := reply["info"].([]interface{})
+	if len(info) == 0 {
+		return nil, fmt.Errorf("request video upload url: empty reply")
+	}
+	infoMap, _ := info[0].(map[string]interface{})
+	uploadURL, _ := infoMap["url"].(string)
+	videoID := infoMap["videoId"]
+	token, _ := infoMap["token"].(string)
+
+	key := "video:" + idString(videoID)
+	done := c.expectAttach(key)
+
+	if _, err := c.uploadHTTP(uploadURL, o.name, r, token, o.progress); err != nil {
+		c.waitCancel(key)
+		return nil, fmt.Errorf("upload video: %w", err)
+	}
+	if err := c.waitAttach(key, done); err != nil {
+		return nil, err
+	}
+
+	attach := map[string]interface{}{
+		"_type":   "VIDEO",
+		"videoId": videoID,
+		"token":   token,
+	}
+	if o.duration > 0 {
+		attach["duration"] = o.duration.Milliseconds()
+	}
+	if o.width > 0 && o.height > 0 {
+		attach["width"] = o.width
+		attach["height"] = o.height
+	}
+	return attach, nil
+}
+
+// uploadPhoto загружает фото (opcode 80). Сервер возвращает токен фото в теле HTTP ответа
+func (c *ChatClient) uploadPhoto(r io.Reader, o *sendOptions) (map[string]interface{}, error) {
+	if o.stripMetadata {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = stripMetadata(data, o.keepOrientation); err != nil {
+			return nil, fmt.Errorf("strip photo metadata: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	reply, err := c.request(80, map[string]interface{}{"count": 1}, "Request URL to send photo")
+	if err != nil {
+		return nil, fmt.Errorf("request photo upload url: %w", err)
+	}
+	uploadURL, _ := reply["url"].(string)
+	if uploadURL == "" {
+		return nil, fmt.Errorf("request photo upload url: empty reply")
+	}
+
+	body, err := c.uploadHTTP(uploadURL, o.name, r, "", o.progress)
+	if err != nil {
+		return nil, fmt.Errorf("upload photo: %w", err)
+	}
+
+	var result struct {
+		Photos map[string]struct {
+			Token string `json:"token"`
+		} `json:"photos"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("upload photo: %w", err)
+	}
+	for _, photo := range result.Photos {
+		return map[string]interface{}{
+			"_type":      "PHOTO",
+			"photoToken": photo.Token,
+		}, nil
+	}
+	return nil, fmt.Errorf("upload photo: no photo token in reply")
+}
+
+// uploadFile загружает файл (opcode 87) и ждет завершения его обработки
+func (c *ChatClient) uploadFile(r io.Reader, o *sendOptions) (interface{}, string, error) {
+	slots, err := c.requestFileSlots(1)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := c.uploadToSlot(slots[0], o.name, r, o.progress); err != nil {
+		return nil, "", err
+	}
+	return slots[0].fileID, slots[0].token, nil
+}
+
+// fileSlot — адрес для загрузки одного файла, выданный сервером
+type fileSlot struct {
+	url    string
+	fileID interface{}
+	token  string
+}
+
+// requestFileSlots запрашивает count адресов для загрузки файлов (opcode 87)
+func (c *ChatClient) requestFileSlots(count int) ([]fileSlot, error) {
+	reply, err := c.request(87, map[string]interface{}{"count": count}, "Request URL to send file")
+	if err != nil {
+		return nil, fmt.Errorf("request file upload url: %w", err)
+	}
+	info, _ := reply["info"].([]interface{})
+	if len(info) < count {
+		return nil, fmt.Errorf("request file upload url: got %d slots, want %d", len(info), count)
+	}
+
+	slots := make([]fileSlot, 0, count)
+	for _, item := range info[:count] {
+		infoMap, _ := item.(map[string]interface{})
+		url, _ := infoMap["url"].(string)
+		token, _ := infoMap["token"].(string)
+		slots = append(slots, fileSlot{url: url, fileID: infoMap["fileId"], token: token})
+	}
+	return slots, nil
+}
+
+// uploadToSlot загружает файл по выданному адресу и ждет завершения его обработки
+func (c *ChatClient) uploadToSlot(slot fileSlot, name string, r io.Reader, progress ProgressFunc) error {
+	key := "file:" + idString(slot.fileID)
+	done := c.expectAttach(key)
+
+	if _, err := c.uploadHTTP(slot.url, name, r, slot.token, progress); err != nil {
+		c.waitCancel(key)
+		return fmt.Errorf("upload file: %w", err)
+	}
+	return c.waitAttach(key, done)
+}
+
+// sendAttaches отправляет сообщение с вложениями и ждет подтверждения сервера
+func (c *ChatClient) sendAttaches(chatID interface{}, text string, attaches []interface{}, sendType string) error {
+	_, err := c.request(64, map[string]interface{}{
+		"chatId": chatID,
+		"message": map[string]interface{}{
+			"text":     text,
+			"cid":      time.Now().UnixMilli(),
+			"elements": []interface{}{},
+			"attaches": attaches,
+		},
+		"notify": true,
+	}, sendType)
+	return err
+}
+
+// waitCancel снимает ожидание, зарегистрированное через expectAttach
+func (c *ChatClient) waitCancel(key string) {
+	c.pendingMu.Lock()
+	delete(c.attachWaiters, key)
+	c.pendingMu.Unlock()
+}
+
+// uploadHTTP загружает содержимое r на выданный сервером URL и возвращает тело ответа
+func (c *ChatClient) uploadHTTP(url, name string, r io.Reader, token string, progress ProgressFunc) ([]byte, error) {
+	if progress != nil {
+		r = &progressReader{r: r, tracker: newProgressTracker(progress, name, readerSize(r), 0)}
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+
+	go func() {
+		part, err := form.CreateFormFile("file", name)
+		if err == nil {
+			var n int64
+			n, err = io.Copy(part, r)
+			atomic.AddUint64(&c.uploaded, uint64(n))
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return nil, fmt.Errorf("%w: %s", ErrFileTooLarge, string(bodyBytes))
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	c.logger.Debug("file uploaded", "name", name)
+	return bodyBytes, nil
+}
+
+// uploadVoice загружает Ogg/Opus запись как голосовое сообщение
+func (c *ChatClient) uploadVoice(r io.Reader, o *sendOptions) (map[string]interface{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read voice: %w", err)
+	}
+	duration := o.duration
+	if duration == 0 {
+		duration, err = oggOpusDuration(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fileID, token, err := c.uploadFile(bytes.NewReader(data), o)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"_type":    "AUDIO",
+		"audioId":  fileID,
+		"token":    token,
+		"duration": duration.Milliseconds(),
+	}, nil
+}
@@ -0,0 +1,108 @@
+package maxclientapi
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VideoRendition описывает один из доступных вариантов видео
+type VideoRendition struct {
+	Name   string // ключ из ответа сервера, например "MP4_720" или "HLS"
+	Height int    // высота кадра для MP4, 0 для потоковых форматов
+	URL    string
+}
+
+// VideoURLs содержит ответ на запрос ссылки на видео (opcode 83)
+type VideoURLs struct {
+	VideoID   interface{}
+	ChatID    interface{}
+	MessageID interface{}
+
+	// MP4 варианты, отсортированные по убыванию высоты
+	Renditions []VideoRendition
+	HLS        string
+	External   string
+}
+
+// parseVideoURLs разбирает ответ opcode 83 в список вариантов
+func parseVideoURLs(payload map[string]interface{}) *VideoURLs {
+	urls := &VideoURLs{}
+	for key, value := range payload {
+		url, ok := value.(string)
+		if !ok || url == "" {
+			continue
+		}
+		switch {
+		case key == "HLS":
+			urls.HLS = url
+		case key == "EXTERNAL":
+			urls.External = url
+		case strings.HasPrefix(key, "MP4_"):
+			height, err := strconv.Atoi(strings.TrimPrefix(key, "MP4_"))
+			if err != nil {
+				continue
+			}
+			urls.Renditions = append(urls.Renditions, VideoRendition{Name: key, Height: height, URL: url})
+		}
+	}
+	sort.Slice(urls.Renditions, func(i, j int) bool {
+		return urls.Renditions[i].Height > urls.Renditions[j].Height
+	})
+	return urls
+}
+
+// BestVideoURL возвращает MP4 ссылку наибольшего качества, не превышающего maxHeight
+// (0 — без ограничения). Если все варианты выше лимита, возвращается наименьший.
+// Без MP4 возвращается HLS, затем EXTERNAL.
+func (v *VideoURLs) BestVideoURL(maxHeight int) string {
+	for _, rendition := range v.Renditions {
+		if maxHeight <= 0 || rendition.Height <= maxHeight {
+			return rendition.URL
+		}
+	}
+	if len(v.Renditions) > 0 {
+		return v.Renditions[len(v.Renditions)-1].URL
+	}
+	if v.HLS != "" {
+		return v.HLS
+	}
+	return v.External
+}
+
+// FetchVideoURLs запрашивает ссылки на видео и ждет ответ сервера
+func (c *ChatClient) FetchVideoURLs(videoID, chatID, messageID interface{}) (*VideoURLs, error) {
+	reply, err := c.request(83, map[string]interface{}{
+		"videoId":   videoID,
+		"chatId":    chatID,
+		"messageId": messageID,
+	}, "Get video URL")
+	if err != nil {
+		return nil, err
+	}
+	urls := parseVideoURLs(reply)
+	urls.VideoID, urls.ChatID, urls.MessageID = videoID, chatID, messageID
+	return urls, nil
+}
+
+// videoRequest — запрос GetVideoURL, ожидающий ответа opcode 83
+type videoRequest struct {
+	videoID   interface{}
+	chatID    interface{}
+	messageID interface{}
+	expires   time.Time
+}
+
+// dropVideoRequests удаляет запросы GetVideoURL с seq не больше maxSeq
+// и запросы, ответ на которые не пришел за время ожидания
+func (c *ChatClient) dropVideoRequests(maxSeq int) {
+	now := time.Now()
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	for seq, req := range c.videoRequests {
+		if seq <= maxSeq || now.After(req.expires) {
+			delete(c.videoRequests, seq)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package maxclientapi
+
+import (
+	"testing"
+	"time"
+)
+
+func (c *ChatClient) videoRequestCount() int {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	return len(c.videoRequests)
+}
+
+func TestVideoRequestsAreDropped(t *testing.T) {
+	server := newTestServer(t)
+	answer := make(chan bool, 1)
+	answer <- false
+	server.reply = func(frame map[string]interface{}) map[string]interface{} {
+		frame["cmd"] = 1
+		frame["payload"] = map[string]interface{}{}
+		if frame["opcode"].(float64) == 83 {
+			ok := <-answer
+			answer <- ok
+			if !ok {
+				return nil
+			}
+			frame["payload"] = map[string]interface{}{"MP4_720": "https://video/720"}
+		}
+		return frame
+	}
+	c := server.client(WithAllowReconnect(true), WithRequestTimeout(100*time.Millisecond))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, c)
+	defer c.Stop()
+
+	// Без ответа запросы удаляются по истечении времени ожидания
+	for i := 0; i < 3; i++ {
+		c.GetVideoURL(i, 1, 1)
+	}
+	if n := c.videoRequestCount(); n != 3 {
+		t.Fatalf("pending = %d, want 3", n)
+	}
+	time.Sleep(150 * time.Millisecond)
+	c.GetVideoURL(3, 1, 1)
+	if n := c.videoRequestCount(); n != 1 {
+		t.Fatalf("pending = %d after timeout, want 1", n)
+	}
+
+	// После переподключения ответы на старые запросы не придут
+	server.dropAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.videoRequestCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("requests from the dropped connection are kept")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Ответ связывается с запросом и удаляет его
+	<-answer
+	answer <- true
+	waitReady(t, c)
+	for c.State() != StateReady {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.GetVideoURL(42, 1, 1)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-c.Messages():
+			if event["type"] != "download_link" {
+				continue
+			}
+			if event["videoId"] != 42 || event["video_url"] != "https://video/720" {
+				t.Fatalf("event = %v", event)
+			}
+			if n := c.videoRequestCount(); n != 0 {
+				t.Fatalf("pending = %d after reply, want 0", n)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no download_link event")
+		}
+	}
+}